@@ -0,0 +1,190 @@
+package cql
+
+import (
+	"slices"
+	"strings"
+)
+
+// URIs of well-known context sets.
+const (
+	ContextSetCQL  = "info:srw/cql-context-set/1/cql-v1.2"
+	ContextSetDC   = "info:srw/cql-context-set/1/dc-v1.1"
+	ContextSetBath = "http://zing.z3950.org/cql/bath/2.0/"
+	ContextSetRec  = "info:srw/cql-context-set/2/rec-1.1"
+	ContextSetSRW  = "info:srw/cql-context-set/1/cql-v1.1"
+	ContextSetSort = "info:srw/cql-context-set/1/sort-v1.0"
+	ContextSetNet  = "info:srw/cql-context-set/2/net-1.0"
+)
+
+// Named relations of the cql context set, which are relations without a prefix.
+var cqlNamedRelations = []Relation{ADJ, ALL, ANY, ENCLOSES, EXACT, SCR, WITHIN}
+
+// Represents a context set with the prefix it is usually bound to.
+// Names are compared case-insensitively and without prefix, e.g. "title" for `dc.title`.
+// A nil list means that the names of that kind are not known and any name is accepted.
+type ContextSet struct {
+	Prefix    string
+	Uri       string
+	Indexes   []string
+	Relations []Relation
+	Modifiers []string // relation, boolean and sort modifiers
+}
+
+func containsFold(list []string, name string) bool {
+	return slices.ContainsFunc(list, func(s string) bool {
+		return strings.EqualFold(s, name)
+	})
+}
+
+// HasIndex returns true if the index is defined by the context set.
+func (cs *ContextSet) HasIndex(name string) bool {
+	return cs.Indexes == nil || containsFold(cs.Indexes, name)
+}
+
+// HasRelation returns true if the relation is defined by the context set.
+func (cs *ContextSet) HasRelation(name string) bool {
+	return cs.Relations == nil || slices.ContainsFunc(cs.Relations, func(r Relation) bool {
+		return strings.EqualFold(string(r), name)
+	})
+}
+
+// HasModifier returns true if the modifier is defined by the context set.
+func (cs *ContextSet) HasModifier(name string) bool {
+	return cs.Modifiers == nil || containsFold(cs.Modifiers, name)
+}
+
+// Registry of context sets by URI and by prefix.
+type ContextSetRegistry struct {
+	sets []*ContextSet
+}
+
+// NewContextSetRegistry returns a registry with the given context sets.
+func NewContextSetRegistry(sets ...*ContextSet) *ContextSetRegistry {
+	r := &ContextSetRegistry{}
+	for _, set := range sets {
+		r.Register(set)
+	}
+	return r
+}
+
+// DefaultContextSets returns a new registry with the context sets cql, dc, bath, rec, srw, sort and net.
+// The indexes of bath, rec and net are not listed, so any index is accepted for them.
+func DefaultContextSets() *ContextSetRegistry {
+	var modifiers []string
+	for _, m := range []CqlModifier{Stem, Relevant, Phonetic, Fuzzy, Partial, IgnoreCase, RespectCase,
+		IgnoreAccents, RespectAccents, Locale, Word, String, IsoDate, Number, Uri, Oid, Masked, Unmasked,
+		Substring, Regexp, Distance, Unit, Unordered, Ordered} {
+		modifiers = append(modifiers, string(m))
+	}
+	cqlRelations := append([]Relation{EQ, "==", NE, LT, GT, LE, GE}, cqlNamedRelations...)
+	var cqlIndexes []string
+	for _, index := range []CqlIndex{AllRecords, AllIndexes, AnyIndexes, Anywhere, Keywords, ServerChoice, ResultSetId} {
+		cqlIndexes = append(cqlIndexes, strings.TrimPrefix(string(index), "cql."))
+	}
+	return NewContextSetRegistry(
+		&ContextSet{Prefix: "cql", Uri: ContextSetCQL, Indexes: cqlIndexes, Relations: cqlRelations, Modifiers: modifiers},
+		&ContextSet{Prefix: "dc", Uri: ContextSetDC, Indexes: []string{"title", "creator", "subject", "description",
+			"publisher", "contributor", "date", "type", "format", "identifier", "source", "language", "relation",
+			"coverage", "rights"}, Relations: []Relation{}, Modifiers: []string{}},
+		&ContextSet{Prefix: "bath", Uri: ContextSetBath, Relations: []Relation{}, Modifiers: []string{}},
+		&ContextSet{Prefix: "rec", Uri: ContextSetRec},
+		&ContextSet{Prefix: "srw", Uri: ContextSetSRW, Indexes: cqlIndexes, Relations: cqlRelations, Modifiers: modifiers},
+		&ContextSet{Prefix: "sort", Uri: ContextSetSort, Indexes: []string{}, Relations: []Relation{},
+			Modifiers: []string{"ascending", "descending", "ignoreCase", "respectCase", "ignoreAccents",
+				"respectAccents", "missingOmit", "missingFail", "missingLow", "missingHigh", "missingValue",
+				"locale", "unicodeCollate"}},
+		&ContextSet{Prefix: "net", Uri: ContextSetNet},
+	)
+}
+
+// Register adds a context set, replacing a set with the same URI.
+func (r *ContextSetRegistry) Register(set *ContextSet) *ContextSetRegistry {
+	r.sets = slices.DeleteFunc(r.sets, func(s *ContextSet) bool {
+		return s.Uri == set.Uri
+	})
+	r.sets = append(r.sets, set)
+	return r
+}
+
+// ByUri returns the context set with the URI or nil.
+func (r *ContextSetRegistry) ByUri(uri string) *ContextSet {
+	for _, set := range r.sets {
+		if set.Uri == uri {
+			return set
+		}
+	}
+	return nil
+}
+
+// ByPrefix returns the context set usually bound to the prefix or nil.
+func (r *ContextSetRegistry) ByPrefix(prefix string) *ContextSet {
+	for _, set := range r.sets {
+		if strings.EqualFold(set.Prefix, prefix) {
+			return set
+		}
+	}
+	return nil
+}
+
+// ResolvePrefix returns the URI bound to a prefix by the innermost declaration of the prefix maps,
+// innermost last, or else the URI of the registered set usually bound to the prefix.
+// An empty prefix gives the default context set declared by the query, if any.
+// It returns an empty string if the prefix is unknown.
+func (r *ContextSetRegistry) ResolvePrefix(prefix string, prefixMaps ...[]Prefix) string {
+	for i := len(prefixMaps) - 1; i >= 0; i-- {
+		for _, p := range prefixMaps[i] {
+			if strings.EqualFold(p.Prefix, prefix) {
+				return p.Uri
+			}
+		}
+	}
+	if prefix == "" {
+		return ""
+	}
+	if set := r.ByPrefix(prefix); set != nil {
+		return set.Uri
+	}
+	return ""
+}
+
+// lookup returns the context set and name without prefix for a name used in a query.
+// unprefixed is the URI of names without prefix, or empty if they are not validated.
+func (r *ContextSetRegistry) lookup(name string, prefixMaps [][]Prefix, unprefixed string) (*ContextSet, string, string) {
+	prefix, rest, found := strings.Cut(name, ".")
+	uri := unprefixed
+	if found {
+		uri = r.ResolvePrefix(prefix, prefixMaps...)
+		if uri == "" {
+			return nil, rest, "unknown prefix " + prefix
+		}
+	} else {
+		rest = name
+	}
+	if uri == "" {
+		return nil, rest, ""
+	}
+	// names of a context set missing from the registry, e.g. cql, are not validated
+	return r.ByUri(uri), rest, ""
+}
+
+// check returns the error message for an index, relation or modifier not defined by its context set,
+// or an empty string if it is defined.
+func (r *ContextSetRegistry) check(kind string, name string, prefixMaps [][]Prefix, unprefixed string) string {
+	set, rest, msg := r.lookup(name, prefixMaps, unprefixed)
+	if msg != "" || set == nil {
+		return msg
+	}
+	var ok bool
+	switch kind {
+	case "index":
+		ok = set.HasIndex(rest)
+	case "relation":
+		ok = set.HasRelation(rest)
+	default:
+		ok = set.HasModifier(rest)
+	}
+	if !ok {
+		return "unknown " + kind + " " + name
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package cql
+
+import "testing"
+
+func TestContextSetRegistry(t *testing.T) {
+	r := DefaultContextSets()
+	for _, prefix := range []string{"cql", "dc", "bath", "rec", "srw", "sort", "net"} {
+		set := r.ByPrefix(prefix)
+		if set == nil {
+			t.Fatalf("missing context set %s", prefix)
+		}
+		if r.ByUri(set.Uri) != set {
+			t.Fatalf("context set %s not found by URI %s", prefix, set.Uri)
+		}
+	}
+	if r.ByPrefix("x") != nil || r.ByUri("x") != nil {
+		t.Fatalf("unexpected context set x")
+	}
+	if uri := r.ResolvePrefix("dc"); uri != ContextSetDC {
+		t.Fatalf("expected %s, got %s", ContextSetDC, uri)
+	}
+	scopes := [][]Prefix{{{Prefix: "dc", Uri: "outer"}}, {{Prefix: "DC", Uri: "inner"}}}
+	if uri := r.ResolvePrefix("dc", scopes...); uri != "inner" {
+		t.Fatalf("expected inner, got %s", uri)
+	}
+	if uri := r.ResolvePrefix("", scopes...); uri != "" {
+		t.Fatalf("expected no default set, got %s", uri)
+	}
+	if uri := r.ResolvePrefix("", []Prefix{{Uri: ContextSetDC}}); uri != ContextSetDC {
+		t.Fatalf("expected %s, got %s", ContextSetDC, uri)
+	}
+	if uri := r.ResolvePrefix("x"); uri != "" {
+		t.Fatalf("expected unknown prefix, got %s", uri)
+	}
+
+	cqlSet := r.ByUri(ContextSetCQL)
+	if !cqlSet.HasIndex("serverchoice") || cqlSet.HasIndex("title") {
+		t.Fatalf("unexpected cql indexes %v", cqlSet.Indexes)
+	}
+	if !cqlSet.HasRelation("ADJ") || !cqlSet.HasRelation("<=") || cqlSet.HasRelation("near") {
+		t.Fatalf("unexpected cql relations %v", cqlSet.Relations)
+	}
+	if !cqlSet.HasModifier("ignorecase") || cqlSet.HasModifier("ascending") {
+		t.Fatalf("unexpected cql modifiers %v", cqlSet.Modifiers)
+	}
+	if net := r.ByPrefix("net"); !net.HasIndex("anything") || !net.HasModifier("anything") {
+		t.Fatalf("unlisted names should be accepted")
+	}
+
+	// register replaces a set with the same URI
+	r.Register(&ContextSet{Prefix: "mydc", Uri: ContextSetDC, Indexes: []string{"title"}})
+	if r.ByPrefix("dc") != nil || r.ByPrefix("mydc") == nil {
+		t.Fatalf("context set not replaced")
+	}
+	custom := NewContextSetRegistry(&ContextSet{Prefix: "x", Uri: "http://example.com/x", Indexes: []string{"a"}})
+	p := Parser{ContextSets: custom}
+	if _, err := p.Parse("x.a = b"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := p.Parse("dc.title = b"); err == nil {
+		t.Fatalf("expected error for prefix unknown to the registry")
+	}
+	// DefaultContextSets returns a new registry every time
+	if DefaultContextSets().ByPrefix("dc") == nil {
+		t.Fatalf("default context sets modified")
+	}
+}
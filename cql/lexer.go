@@ -1,6 +1,7 @@
 package cql
 
 import (
+	"slices"
 	"strings"
 	"unicode/utf8"
 )
@@ -144,13 +145,9 @@ func (l *lexer) lex() (tok token, value string) {
 		if strings.EqualFold(value, "sortby") {
 			return tokenSortby, value
 		}
-		if strings.EqualFold(value, "all") ||
-			strings.EqualFold(value, "any") ||
-			strings.EqualFold(value, "adj") ||
-			strings.EqualFold(value, "scr") ||
-			strings.EqualFold(value, "exact") ||
-			strings.EqualFold(value, "within") ||
-			strings.EqualFold(value, "encloses") {
+		if slices.ContainsFunc(cqlNamedRelations, func(r Relation) bool {
+			return strings.EqualFold(value, string(r))
+		}) {
 			return tokenRelSym, value
 		}
 		if isPrefixName {
@@ -1,6 +1,7 @@
 package cql
 
 import (
+	"errors"
 	"fmt"
 	"slices"
 	"strings"
@@ -8,11 +9,25 @@ import (
 
 const combiningTildeBelow = string('\u0330')
 
+// Errors for queries exceeding the limits of a Parser, wrapped in a ParseError.
+var (
+	ErrMaxLength    = errors.New("query too long")
+	ErrMaxDepth     = errors.New("query nested too deeply")
+	ErrMaxClauses   = errors.New("too many search clauses")
+	ErrMaxTerms     = errors.New("too many words in term")
+	ErrMaxModifiers = errors.New("too many modifiers")
+)
+
+// Error for prefixes, indexes, relations and modifiers unknown to the ContextSets of a Parser,
+// wrapped in a ParseError.
+var ErrContextSet = errors.New("unknown context set name")
+
 // Indicates query parsing error
 type ParseError struct {
 	query   string
 	message string
 	pos     int
+	err     error
 }
 
 // Formats error for display
@@ -35,17 +50,34 @@ func (e *ParseError) Query() string {
 	return e.query
 }
 
+// Unwrap returns the limit exceeded, e.g. ErrMaxDepth, ErrContextSet, or nil for syntax errors
+func (e *ParseError) Unwrap() error {
+	return e.err
+}
+
 // Query with the error position marked
 func (e *ParseError) Marked() string {
 	return e.query[:e.pos] + combiningTildeBelow + e.query[e.pos:]
 }
 
-// CQL parser, non-strict by default
+// CQL parser, non-strict by default.
+// The limits are disabled when 0 and yield a ParseError wrapping ErrMaxLength, ErrMaxDepth and so on.
+// If ContextSets is set, the query is validated against the context sets and names unknown to them
+// yield a ParseError wrapping ErrContextSet. Indexes without prefix are only validated if the query
+// declares a default context set, e.g. `> "info:srw/cql-context-set/1/dc-v1.1" title = fish`.
 type Parser struct {
-	Strict bool //if true, multi term values, e.g. `a b c` are not allowed
-	look   token
-	value  string
-	lexer  lexer
+	Strict       bool                //if true, multi term values, e.g. `a b c` are not allowed
+	MaxLength    int                 // maximum length of the query in bytes
+	MaxDepth     int                 // maximum nesting of parentheses
+	MaxClauses   int                 // maximum number of search clauses
+	MaxTerms     int                 // maximum number of words in a multi term value, e.g. 3 for `a b c`
+	MaxModifiers int                 // maximum number of modifiers of a relation, boolean or sort key
+	ContextSets  *ContextSetRegistry // if set, prefixes and names are validated, e.g. DefaultContextSets()
+	look         token
+	value        string
+	lexer        lexer
+	depth        int
+	clauses      int
 }
 
 type context struct {
@@ -54,6 +86,40 @@ type context struct {
 	relation_mods []Modifier
 	prefixes      []string
 	custom        bool
+	prefixMaps    [][]Prefix
+}
+
+func (p *Parser) limitError(err error) *ParseError {
+	return &ParseError{p.lexer.input, err.Error(), p.lexer.pos, err}
+}
+
+// checkName validates an index, relation or modifier against the context sets.
+// unprefixed is the URI of the context set of names without prefix, or empty if they are not validated.
+func (p *Parser) checkName(kind string, name string, prefixMaps [][]Prefix, unprefixed string, pos int) error {
+	if p.ContextSets == nil {
+		return nil
+	}
+	if msg := p.ContextSets.check(kind, name, prefixMaps, unprefixed); msg != "" {
+		return &ParseError{p.lexer.input, msg, pos, ErrContextSet}
+	}
+	return nil
+}
+
+func (p *Parser) checkModifiers(mods []Modifier, prefixMaps [][]Prefix, unprefixed string, pos int) error {
+	for _, mod := range mods {
+		if err := p.checkName("modifier", mod.Name, prefixMaps, unprefixed, pos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultSet returns the URI of the default context set declared by the query or else the cql context set.
+func (p *Parser) defaultSet(prefixMaps [][]Prefix) string {
+	if uri := p.ContextSets.ResolvePrefix("", prefixMaps...); uri != "" {
+		return uri
+	}
+	return ContextSetCQL
 }
 
 func (p *Parser) next() {
@@ -82,7 +148,7 @@ func (p *Parser) modifiers() ([]Modifier, error) {
 	for p.look == tokenModifier {
 		p.next()
 		if !p.isSearchTerm() {
-			return mods, &ParseError{p.lexer.input, "missing modifier key", p.lexer.pos}
+			return mods, &ParseError{p.lexer.input, "missing modifier key", p.lexer.pos, nil}
 		}
 		modifier := p.value
 		p.next()
@@ -90,7 +156,7 @@ func (p *Parser) modifiers() ([]Modifier, error) {
 			relation := Relation(p.value)
 			p.next()
 			if !p.isSearchTerm() {
-				return mods, &ParseError{p.lexer.input, "missing modifier value", p.lexer.pos}
+				return mods, &ParseError{p.lexer.input, "missing modifier value", p.lexer.pos, nil}
 			}
 			mod := Modifier{Name: modifier, Relation: relation, Value: p.value}
 			p.next()
@@ -99,50 +165,89 @@ func (p *Parser) modifiers() ([]Modifier, error) {
 			mod := Modifier{Name: modifier}
 			mods = append(mods, mod)
 		}
+		if p.MaxModifiers > 0 && len(mods) > p.MaxModifiers {
+			return mods, p.limitError(ErrMaxModifiers)
+		}
 	}
 	return mods, nil
 }
 
 func (p *Parser) searchClause(ctx *context) (Clause, error) {
 	if p.look == tokenLp {
+		p.depth++
+		if p.MaxDepth > 0 && p.depth > p.MaxDepth {
+			return Clause{}, p.limitError(ErrMaxDepth)
+		}
 		p.next()
 		node, err := p.cqlQuery(ctx)
 		if err != nil {
 			return node, err
 		}
 		if p.look != tokenRp {
-			return node, &ParseError{p.lexer.input, "missing )", p.lexer.pos}
+			return node, &ParseError{p.lexer.input, "missing )", p.lexer.pos, nil}
 		}
+		p.depth--
 		p.next()
 		return node, nil
 	}
 	var node Clause
 	if !p.isSearchTerm() {
-		return node, &ParseError{p.lexer.input, "search term expected", p.lexer.pos}
+		return node, &ParseError{p.lexer.input, "search term expected", p.lexer.pos, nil}
 	}
 	indexOrTerm := p.value
 	relPos := p.lexer.pos
 	p.next()
 	if p.isRelation(ctx.prefixes, ctx.custom) {
+		if p.ContextSets != nil {
+			if err := p.checkName("index", indexOrTerm, ctx.prefixMaps, p.ContextSets.ResolvePrefix("", ctx.prefixMaps...), relPos); err != nil {
+				return node, err
+			}
+		}
 		relation := Relation(p.value)
+		// symbolic and named relations belong to the cql context set, other relations without prefix
+		// to the default context set declared by the query
+		relSet := ContextSetCQL
+		if p.ContextSets != nil {
+			switch p.look {
+			case tokenSimpleString:
+				relSet = p.defaultSet(ctx.prefixMaps)
+			case tokenPrefixName:
+				relSet = p.ContextSets.ResolvePrefix(strings.Split(p.value, ".")[0], ctx.prefixMaps...)
+			}
+		}
 		p.next()
 		mods, err := p.modifiers()
 		if err != nil {
 			return node, err
 		}
-		ctx := context{index: indexOrTerm, relation: relation, relation_mods: mods, prefixes: ctx.prefixes, custom: ctx.custom}
+		if err := p.checkName("relation", string(relation), ctx.prefixMaps, relSet, relPos); err != nil {
+			return node, err
+		}
+		if err := p.checkModifiers(mods, ctx.prefixMaps, relSet, p.lexer.pos); err != nil {
+			return node, err
+		}
+		ctx := context{index: indexOrTerm, relation: relation, relation_mods: mods, prefixes: ctx.prefixes, custom: ctx.custom, prefixMaps: ctx.prefixMaps}
 		return p.searchClause(&ctx)
 	}
 	var sb strings.Builder
 	sb.WriteString(indexOrTerm)
+	terms := 1
 	for p.look == tokenSimpleString || p.look == tokenPrefixName || p.look == tokenRelSym {
 		if p.Strict {
-			return node, &ParseError{p.lexer.input, "relation expected", relPos}
+			return node, &ParseError{p.lexer.input, "relation expected", relPos, nil}
 		} else {
+			terms++
+			if p.MaxTerms > 0 && terms > p.MaxTerms {
+				return node, p.limitError(ErrMaxTerms)
+			}
 			sb.WriteString(" " + p.value)
 			p.next()
 		}
 	}
+	p.clauses++
+	if p.MaxClauses > 0 && p.clauses > p.MaxClauses {
+		return node, p.limitError(ErrMaxClauses)
+	}
 	sc := SearchClause{Index: ctx.index, Relation: ctx.relation, Term: sb.String(), Modifiers: ctx.relation_mods}
 	node.SearchClause = &sc
 	return node, nil
@@ -172,6 +277,9 @@ func (p *Parser) scopedClause(ctx *context) (Clause, error) {
 		if err != nil {
 			return left, err
 		}
+		if err := p.checkModifiers(mods, ctx.prefixMaps, ContextSetCQL, p.lexer.pos); err != nil {
+			return left, err
+		}
 		right, err := p.searchClause(ctx)
 		if err != nil {
 			return left, err
@@ -188,7 +296,7 @@ func (p *Parser) cqlQuery(ctx *context) (Clause, error) {
 	for p.look == tokenRelOp && p.value == ">" {
 		p.next()
 		if p.look != tokenSimpleString {
-			return node, &ParseError{p.lexer.input, "prefix or uri expected", p.lexer.pos}
+			return node, &ParseError{p.lexer.input, "prefix or uri expected", p.lexer.pos, nil}
 		}
 		var uri string
 		value := p.value
@@ -196,7 +304,7 @@ func (p *Parser) cqlQuery(ctx *context) (Clause, error) {
 		if p.look == tokenRelOp && p.value == "=" {
 			p.next()
 			if p.look != tokenSimpleString {
-				return node, &ParseError{p.lexer.input, "uri expected", p.lexer.pos}
+				return node, &ParseError{p.lexer.input, "uri expected", p.lexer.pos, nil}
 			}
 			uri = p.value
 			subctx.prefixes = append(ctx.prefixes, value)
@@ -206,24 +314,39 @@ func (p *Parser) cqlQuery(ctx *context) (Clause, error) {
 			uri = value
 			value = ""
 		}
+		if p.ContextSets != nil && p.ContextSets.ByUri(uri) == nil {
+			return node, &ParseError{p.lexer.input, "unknown context set " + uri, p.lexer.pos, ErrContextSet}
+		}
 		prefix := Prefix{Prefix: value, Uri: uri}
 		prefixes = append(prefixes, prefix)
 	}
+	if len(prefixes) > 0 {
+		subctx.prefixMaps = append(ctx.prefixMaps[:len(ctx.prefixMaps):len(ctx.prefixMaps)], prefixes)
+	}
 	node, err := p.scopedClause(&subctx)
 	node.PrefixMap = prefixes
 	return node, err
 }
 
-func (p *Parser) sortKeys() ([]Sort, error) {
+func (p *Parser) sortKeys(prefixMaps [][]Prefix) ([]Sort, error) {
 	var sortList []Sort
 
 	for p.isSearchTerm() {
 		index := p.value
+		pos := p.lexer.pos
 		p.next()
+		if p.ContextSets != nil {
+			if err := p.checkName("index", index, prefixMaps, p.ContextSets.ResolvePrefix("", prefixMaps...), pos); err != nil {
+				return sortList, err
+			}
+		}
 		mods, err := p.modifiers()
 		if err != nil {
 			return sortList, err
 		}
+		if err := p.checkModifiers(mods, prefixMaps, ContextSetSort, p.lexer.pos); err != nil {
+			return sortList, err
+		}
 		sort := Sort{Index: index, Modifiers: mods}
 		sortList = append(sortList, sort)
 	}
@@ -232,6 +355,11 @@ func (p *Parser) sortKeys() ([]Sort, error) {
 
 // Parse input query string into a syntax tree or return an error.
 func (p *Parser) Parse(input string) (Query, error) {
+	p.depth = 0
+	p.clauses = 0
+	if p.MaxLength > 0 && len(input) > p.MaxLength {
+		return Query{}, &ParseError{input, ErrMaxLength.Error(), p.MaxLength, ErrMaxLength}
+	}
 	p.lexer.init(input)
 	p.look, p.value = p.lexer.lex()
 
@@ -245,10 +373,10 @@ func (p *Parser) Parse(input string) (Query, error) {
 	query.Clause = node
 	if p.look == tokenSortby {
 		p.next()
-		query.SortSpec, err = p.sortKeys()
+		query.SortSpec, err = p.sortKeys([][]Prefix{node.PrefixMap})
 	}
 	if p.look != tokenEos {
-		return query, &ParseError{p.lexer.input, "EOF expected", p.lexer.pos}
+		return query, &ParseError{p.lexer.input, "EOF expected", p.lexer.pos, nil}
 	}
 	return query, err
 }
@@ -1111,3 +1111,117 @@ func TestXcqlFailWriter(t *testing.T) {
 		t.Fatalf("expected error but got nil")
 	}
 }
+
+func TestParserLimits(t *testing.T) {
+	for _, testcase := range []struct {
+		name   string
+		parser Parser
+		input  string
+		err    error
+		expect string
+	}{
+		{"length ok", Parser{MaxLength: 5}, "a = b", nil, ""},
+		{"length", Parser{MaxLength: 5}, "a = bc", ErrMaxLength, "query too long at position 5: a = b\u0330c"},
+		{"depth ok", Parser{MaxDepth: 2}, "((a) and b) or (c)", nil, ""},
+		{"depth", Parser{MaxDepth: 2}, "a and ((b or (c)))", ErrMaxDepth, "query nested too deeply at position 15: a and ((b or (c\u0330)))"},
+		{"clauses ok", Parser{MaxClauses: 3}, "a and b or c sortby d e f", nil, ""},
+		{"clauses", Parser{MaxClauses: 3}, "a and b or c not d", ErrMaxClauses, "too many search clauses at position 18: a and b or c not d\u0330"},
+		{"terms ok", Parser{MaxTerms: 2}, "a b and c", nil, ""},
+		{"terms", Parser{MaxTerms: 2}, "x = a b c", ErrMaxTerms, "too many words in term at position 9: x = a b c\u0330"},
+		{"modifiers ok", Parser{MaxModifiers: 2}, "a =/x/y b and/z c sortby d/sort.ascending", nil, ""},
+		{"modifiers", Parser{MaxModifiers: 2}, "a =/x/y/z b", ErrMaxModifiers, "too many modifiers at position 11: a =/x/y/z b\u0330"},
+		{"sort modifiers", Parser{MaxModifiers: 1}, "a sortby b/x/y", ErrMaxModifiers, "too many modifiers at position 14: a sortby b/x/y\u0330"},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			_, err := testcase.parser.Parse(testcase.input)
+			if testcase.err == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, testcase.err) {
+				t.Fatalf("expected %v, got %v", testcase.err, err)
+			}
+			var parseError *ParseError
+			if !errors.As(err, &parseError) {
+				t.Fatalf("expected ParseError, got %T", err)
+			}
+			if err.Error() != testcase.expect {
+				t.Fatalf("expected %q, got %q", testcase.expect, err.Error())
+			}
+		})
+	}
+	// the parser can be reused
+	p := Parser{MaxClauses: 2}
+	for i := 0; i < 3; i++ {
+		if _, err := p.Parse("a and b"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// syntax errors wrap nothing
+	_, err := p.Parse("a and")
+	if errors.Unwrap(err) != nil {
+		t.Fatalf("unexpected wrapped error %v", errors.Unwrap(err))
+	}
+}
+
+func TestParserContextSets(t *testing.T) {
+	dcUri := "info:srw/cql-context-set/1/dc-v1.1"
+	for _, testcase := range []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{"no prefix", "title = fish", ""},
+		{"cql index", "cql.serverChoice = fish", ""},
+		{"dc index", "dc.title = fish", ""},
+		{"index case", "DC.Title = fish", ""},
+		{"unknown dc index", "dc.foo = fish", "unknown index dc.foo"},
+		{"unknown cql index", "cql.foo = fish", "unknown index cql.foo"},
+		{"unknown prefix", "x.title = fish", "unknown prefix x"},
+		{"unlisted indexes", "bath.name = fish", ""},
+		{"declared prefix", "> x = \"" + dcUri + "\" x.title = fish", ""},
+		{"declared prefix unknown index", "> x = \"" + dcUri + "\" x.foo = fish", "unknown index x.foo"},
+		{"declared prefix out of scope", "(> x = \"" + dcUri + "\" x.title = fish) or x.title = fish", "unknown prefix x"},
+		{"unknown uri", "> x = \"http://example.com/set\" x.title = fish", "unknown context set http://example.com/set"},
+		{"default set", "> \"" + dcUri + "\" title = fish", ""},
+		{"default set unknown index", "> \"" + dcUri + "\" foo = fish", "unknown index foo"},
+		{"named relation", "title adj \"a fish\"", ""},
+		{"relation modifiers", "title =/stem/locale=da fish", ""},
+		{"unknown relation modifier", "title =/foo fish", "unknown modifier foo"},
+		{"prefixed relation modifier", "title =/dc.foo fish", "unknown modifier dc.foo"},
+		{"custom relation", "> \"" + dcUri + "\" title foo fish", "unknown relation foo"},
+		{"boolean modifiers", "a prox/distance>2/unit=word b", ""},
+		{"unknown boolean modifier", "a and/foo b", "unknown modifier foo"},
+		{"sort", "a sortby dc.title/sort.descending/missingLow", ""},
+		{"unknown sort modifier", "a sortby title/foo", "unknown modifier foo"},
+		{"unknown sort index", "a sortby dc.foo", "unknown index dc.foo"},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			p := Parser{ContextSets: DefaultContextSets()}
+			_, err := p.Parse(testcase.input)
+			if testcase.expect == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrContextSet) {
+				t.Fatalf("expected ErrContextSet, got %v", err)
+			}
+			var parseError *ParseError
+			if !errors.As(err, &parseError) {
+				t.Fatalf("expected ParseError, got %T", err)
+			}
+			if parseError.Message() != testcase.expect {
+				t.Fatalf("expected %q, got %q", testcase.expect, parseError.Message())
+			}
+			// without context sets the query is valid
+			var lenient Parser
+			if _, err := lenient.Parse(testcase.input); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
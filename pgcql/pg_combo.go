@@ -1,8 +1,6 @@
 package pgcql
 
 import (
-	"strings"
-
 	"github.com/indexdata/cql-go/cql"
 )
 
@@ -27,27 +25,32 @@ func (f *FieldCombo) Sort() string {
 }
 
 func (f *FieldCombo) Generate(sc cql.SearchClause, queryArgumentIndex int) (string, []any, error) {
-	var sqlParts []string
-	var args []any
+	return generateSQL(f, sc, queryArgumentIndex)
+}
+
+func (f *FieldCombo) GenerateExpr(sc cql.SearchClause) (Expr, error) {
+	var expr Expr
 	var err error
 	for _, field := range f.fields {
-		var sql string
-		var fieldArgs []any
-		sql, fieldArgs, err = field.Generate(sc, queryArgumentIndex+len(args))
+		var fieldExpr Expr
+		fieldExpr, err = generateExpr(field, sc)
 		if err != nil {
 			if f.ignoreError {
 				continue
 			}
-			return "", nil, err
+			return nil, err
+		}
+		if expr == nil {
+			expr = fieldExpr
+		} else {
+			expr = &Bool{Op: OpOr, Left: expr, Right: fieldExpr}
 		}
-		sqlParts = append(sqlParts, sql)
-		args = append(args, fieldArgs...)
 	}
-	if len(sqlParts) == 0 {
+	if expr == nil {
 		if err != nil {
-			return "", nil, err
+			return nil, err
 		}
-		return "TRUE", args, nil
+		return Text("TRUE"), nil
 	}
-	return "(" + strings.Join(sqlParts, " OR ") + ")", args, nil
+	return &Paren{Expr: expr}, nil
 }
@@ -0,0 +1,154 @@
+package pgcql
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// cloneableField is implemented by fields that can be copied, so that a definition derived from another
+// can change the fields, e.g. their null policy, without affecting the original.
+// Fields not implementing it are shared by the definitions.
+type cloneableField interface {
+	clone() Field
+}
+
+func (f *FieldString) clone() Field {
+	c := *f
+	return &c
+}
+
+func (f *FieldTsVector) clone() Field {
+	c := *f
+	return &c
+}
+
+func (f *FieldNumber) clone() Field {
+	c := *f
+	return &c
+}
+
+func (f *FieldDateTime) clone() Field {
+	c := *f
+	return &c
+}
+
+func (f *FieldBool) clone() Field {
+	c := *f
+	return &c
+}
+
+func (f *FieldRange) clone() Field {
+	c := *f
+	return &c
+}
+
+func (f *FieldTemplate) clone() Field {
+	c := *f
+	c.templates = maps.Clone(f.templates)
+	return &c
+}
+
+func (f *FieldCombo) clone() Field {
+	c := *f
+	c.fields = make([]Field, len(f.fields))
+	for i, field := range f.fields {
+		c.fields[i] = cloneField(field)
+	}
+	return &c
+}
+
+func (f *FieldRelated) clone() Field {
+	c := *f
+	c.field = cloneField(f.field)
+	return &c
+}
+
+func cloneField(field Field) Field {
+	if cf, ok := field.(cloneableField); ok {
+		return cf.clone()
+	}
+	return field
+}
+
+// Clone returns a copy of the definition, which may then override or remove fields of the original
+// without affecting it, e.g. a definition for a tenant derived from a definition shared by all tenants.
+// Fields are copied, except custom implementations of Field, which are shared. Scope functions are shared.
+// The copy is a snapshot, not a child of the original: later changes of the original are not seen by the copy,
+// and fields missing in the copy are not looked up in the original.
+func (pg *PgDefinition) Clone() *PgDefinition {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+	c := &PgDefinition{
+		nullPolicy:  pg.nullPolicy,
+		aliases:     maps.Clone(pg.aliases),
+		groups:      maps.Clone(pg.groups),
+		scopes:      slices.Clone(pg.scopes),
+		limits:      pg.limits,
+		contextSets: maps.Clone(pg.contextSets),
+		setPrefixes: maps.Clone(pg.setPrefixes),
+		defaultSet:  pg.defaultSet,
+		version:     pg.version,
+	}
+	if pg.fields != nil {
+		c.fields = make(map[string]Field, len(pg.fields))
+		for name, field := range pg.fields {
+			c.fields[name] = cloneField(field)
+		}
+	}
+	if pg.facets != nil {
+		c.facets = make(map[string]*Facet, len(pg.facets))
+		for name, facet := range pg.facets {
+			f := *facet
+			c.facets[name] = &f
+		}
+	}
+	return c
+}
+
+// RemoveField removes a field, e.g. one copied from the definition it was cloned from, and its field group.
+func (pg *PgDefinition) RemoveField(name string) *PgDefinition {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	delete(pg.fields, strings.ToLower(name))
+	delete(pg.groups, strings.ToLower(name))
+	return pg
+}
+
+// RemoveFacet removes a facet.
+func (pg *PgDefinition) RemoveFacet(name string) *PgDefinition {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	delete(pg.facets, strings.ToLower(name))
+	return pg
+}
+
+// Mount adds copies of the fields, facets and field groups of sub with names prefixed by prefix and a dot,
+// e.g. the field "location" of sub becomes "holdings.location" for the prefix "holdings". Existing fields
+// with the same names are overridden. Mounted fields take the null policy of the definition unless set per field,
+// and related fields are given the aliases of the definition unless set by WithAlias.
+// The scopes, limits and context sets of sub are not mounted. Mount panics if sub is nil.
+func (pg *PgDefinition) Mount(prefix string, sub *PgDefinition) *PgDefinition {
+	if sub == nil {
+		panic("pgcql: Mount of nil definition")
+	}
+	mounted := sub.Clone()
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	for name, field := range mounted.fields {
+		if rf, ok := field.(relatedField); ok {
+			rf.clearAliases()
+		}
+		pg.addField(prefix+"."+name, field)
+	}
+	for name, facet := range mounted.facets {
+		pg.addFacet(prefix+"."+name, facet)
+	}
+	if len(mounted.groups) > 0 && pg.groups == nil {
+		pg.groups = make(map[string]string)
+	}
+	for name, group := range mounted.groups {
+		pg.groups[strings.ToLower(prefix+"."+name)] = prefix + "." + group
+	}
+	return pg
+}
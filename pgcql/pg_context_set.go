@@ -0,0 +1,162 @@
+package pgcql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/indexdata/cql-go/cql"
+)
+
+// CQLContextSet is the URI of the cql context set, which is declared with the prefix "cql" by default.
+const CQLContextSet = cql.ContextSetCQL
+
+// knownContextSets are the context sets with the prefixes they are declared with by default, e.g. "dc".
+var knownContextSets = cql.DefaultContextSets()
+
+// WithContextSet declares a context set of the definition. Fields named with the prefix, e.g. "dc.title",
+// belong to the context set with the URI, so a query may use any prefix bound to the URI, e.g.
+// `> x = "http://purl.org/dc/elements/1.1/" x.title = fish`, or no prefix if it is the default context set.
+// The prefix is the one used in field names and in error messages.
+func (pg *PgDefinition) WithContextSet(prefix string, uri string) *PgDefinition {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	if pg.contextSets == nil {
+		pg.contextSets = make(map[string]string)
+		pg.setPrefixes = make(map[string]string)
+	}
+	pg.contextSets[strings.ToLower(prefix)] = uri
+	pg.setPrefixes[uri] = strings.ToLower(prefix)
+	return pg
+}
+
+// WithDefaultContextSet sets the context set of indexes without a prefix. A query may override it with
+// a declaration without prefix, e.g. `> "http://purl.org/dc/elements/1.1/" title = fish`.
+// Indexes without prefix that are not fields of the context set are looked up by name.
+func (pg *PgDefinition) WithDefaultContextSet(uri string) *PgDefinition {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.defaultSet = uri
+	return pg
+}
+
+// prefixURI returns the URI bound to a prefix by the innermost declaration of the scopes,
+// by the definition or by default, or an empty string if the prefix is unknown.
+// The second result is true if the prefix is bound by the scopes, i.e. by the query.
+func (pg *PgDefinition) prefixURI(prefix string, scopes [][]cql.Prefix) (string, bool) {
+	for i := len(scopes) - 1; i >= 0; i-- {
+		for _, p := range scopes[i] {
+			if strings.EqualFold(p.Prefix, prefix) {
+				return p.Uri, true
+			}
+		}
+	}
+	if uri, ok := pg.contextSets[strings.ToLower(prefix)]; ok {
+		return uri, false
+	}
+	return knownContextSets.ResolvePrefix(prefix), false
+}
+
+// setPrefix returns the prefix of the field names of a context set.
+func (pg *PgDefinition) setPrefix(uri string) (string, bool) {
+	if prefix, ok := pg.setPrefixes[uri]; ok {
+		return prefix, true
+	}
+	if set := knownContextSets.ByUri(uri); set != nil {
+		return set.Prefix, true
+	}
+	return "", false
+}
+
+// resolveIndex returns the name of the field for an index, resolving its prefix, or the default context set
+// if it has none, through the prefix declarations of the query, innermost last, and of the definition.
+// The index is returned as is if it does not resolve to a field of a context set, except that a prefix
+// bound by the query must resolve, so that it does not match a field of another context set with that prefix.
+func (pg *PgDefinition) resolveIndex(index string, scopes [][]cql.Prefix) (string, error) {
+	prefix, name, found := strings.Cut(index, ".")
+	var uri string
+	var bound bool
+	if found {
+		uri, bound = pg.prefixURI(prefix, scopes)
+	} else {
+		name = index
+		uri, _ = pg.prefixURI("", scopes)
+		if uri == "" {
+			uri = pg.defaultSet
+		}
+	}
+	if uri == "" {
+		return index, nil
+	}
+	setPrefix, ok := pg.setPrefix(uri)
+	if ok {
+		resolved := setPrefix + "." + name
+		if _, ok := pg.fields[strings.ToLower(resolved)]; ok {
+			return resolved, nil
+		}
+	}
+	if bound {
+		return "", &PgError{message: fmt.Sprintf("unknown field %s", index)}
+	}
+	return index, nil
+}
+
+// resolveClause returns a copy of the clause with the indexes of the search clauses resolved.
+func (pg *PgDefinition) resolveClause(clause cql.Clause, scopes [][]cql.Prefix) (cql.Clause, error) {
+	if len(clause.PrefixMap) > 0 {
+		scopes = append(scopes[:len(scopes):len(scopes)], clause.PrefixMap)
+	}
+	if clause.SearchClause != nil {
+		sc := *clause.SearchClause
+		index, err := pg.resolveIndex(sc.Index, scopes)
+		if err != nil {
+			return clause, err
+		}
+		sc.Index = index
+		clause.SearchClause = &sc
+	}
+	if clause.BoolClause != nil {
+		bc := *clause.BoolClause
+		var err error
+		bc.Left, err = pg.resolveClause(bc.Left, scopes)
+		if err != nil {
+			return clause, err
+		}
+		bc.Right, err = pg.resolveClause(bc.Right, scopes)
+		if err != nil {
+			return clause, err
+		}
+		clause.BoolClause = &bc
+	}
+	return clause, nil
+}
+
+// resolveQuery returns a copy of the query with the indexes of search clauses and sort keys resolved.
+// Sort keys are in the scope of the prefix declarations of the whole query.
+func (pg *PgDefinition) resolveQuery(q cql.Query) (cql.Query, error) {
+	if pg.contextSets == nil && pg.defaultSet == "" && !hasPrefixMap(q.Clause) {
+		return q, nil
+	}
+	clause, err := pg.resolveClause(q.Clause, nil)
+	if err != nil {
+		return q, err
+	}
+	resolved := cql.Query{Clause: clause}
+	for _, sort := range q.SortSpec {
+		sort.Index, err = pg.resolveIndex(sort.Index, [][]cql.Prefix{q.Clause.PrefixMap})
+		if err != nil {
+			return q, err
+		}
+		resolved.SortSpec = append(resolved.SortSpec, sort)
+	}
+	return resolved, nil
+}
+
+func hasPrefixMap(clause cql.Clause) bool {
+	if len(clause.PrefixMap) > 0 {
+		return true
+	}
+	if clause.BoolClause != nil {
+		return hasPrefixMap(clause.BoolClause.Left) || hasPrefixMap(clause.BoolClause.Right)
+	}
+	return false
+}
@@ -1,39 +1,148 @@
 package pgcql
 
 import (
+	"context"
+	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/indexdata/cql-go/cql"
 )
 
+// PgDefinition maps CQL indexes to fields of PostgreSQL tables.
+// It is safe for concurrent use, so a definition may be changed while it generates queries,
+// though a query generated concurrently with a change may or may not see the change.
 type PgDefinition struct {
+	mu     sync.RWMutex
 	fields map[string]Field
+	facets map[string]*Facet
+	// nullPolicy is the default for fields and applies to NOT
+	nullPolicy NullPolicy
+	// aliases of child tables of related fields
+	aliases map[string]string
+	// field groups by lowercase field name
+	groups map[string]string
+	scopes []ScopeFunc
+	limits Limits
+	// context sets by lowercase prefix and prefixes by context set URI
+	contextSets map[string]string
+	setPrefixes map[string]string
+	defaultSet  string
+	version     string
 }
 
+// NewPgDefinition returns an empty definition as a Definition.
+// NewDefinition returns it as a *PgDefinition, with facets, scopes, policies and so on.
 func NewPgDefinition() Definition {
+	return NewDefinition()
+}
+
+// NewDefinition returns an empty definition.
+func NewDefinition() *PgDefinition {
 	return &PgDefinition{}
 }
 
 func (pg *PgDefinition) AddField(name string, field Field) Definition {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.addField(name, field)
+	return pg
+}
+
+func (pg *PgDefinition) addField(name string, field Field) {
 	if field.GetColumn() == "" {
 		field.SetColumn(name)
 	}
+	if rf, ok := field.(relatedField); ok {
+		rf.assignAliases(pg.tableAlias)
+	}
 	if pg.fields == nil {
 		pg.fields = make(map[string]Field)
 	}
 	pg.fields[strings.ToLower(name)] = field
+}
+
+// tableAlias returns the alias of a child table, r1 for the first table, r2 for the next and so on.
+func (pg *PgDefinition) tableAlias(table string) string {
+	if pg.aliases == nil {
+		pg.aliases = make(map[string]string)
+	}
+	alias, ok := pg.aliases[table]
+	if !ok {
+		alias = fmt.Sprintf("r%d", len(pg.aliases)+1)
+		pg.aliases[table] = alias
+	}
+	return alias
+}
+
+// WithNullPolicy sets how NULL values are treated by NOT and by <> of fields without a policy of their own.
+func (pg *PgDefinition) WithNullPolicy(policy NullPolicy) *PgDefinition {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.nullPolicy = policy
 	return pg
 }
 
+// GetFieldType returns the field of an index, resolving its prefix through the context sets of the definition.
 func (pg *PgDefinition) GetFieldType(name string) Field {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+	name, err := pg.resolveIndex(name, nil)
+	if err != nil {
+		return nil
+	}
+	return pg.fieldType(name)
+}
+
+// fieldType returns the field of a name that is resolved already, see resolveQuery.
+func (pg *PgDefinition) fieldType(name string) Field {
 	if field, ok := pg.fields[strings.ToLower(name)]; ok {
 		return field
 	}
 	return nil
 }
 
+func (pg *PgDefinition) AddFacet(name string, facet *Facet) *PgDefinition {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.addFacet(name, facet)
+	return pg
+}
+
+func (pg *PgDefinition) addFacet(name string, facet *Facet) {
+	if facet.GetColumn() == "" {
+		facet.WithColumn(name)
+	}
+	if pg.facets == nil {
+		pg.facets = make(map[string]*Facet)
+	}
+	pg.facets[strings.ToLower(name)] = facet
+}
+
+func (pg *PgDefinition) GetFacet(name string) *Facet {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+	if facet, ok := pg.facets[strings.ToLower(name)]; ok {
+		return facet
+	}
+	return nil
+}
+
+// WithVersion sets the version of the definition, which identifies it in the queries it generates,
+// e.g. a hash of the configuration it was built from.
+func (pg *PgDefinition) WithVersion(version string) *PgDefinition {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.version = version
+	return pg
+}
+
+func (pg *PgDefinition) GetVersion() string {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+	return pg.version
+}
+
 func (pg *PgDefinition) Parse(q cql.Query, queryArgumentIndex int) (Query, error) {
-	query := &PgQuery{}
-	err := query.parse(q, queryArgumentIndex, pg)
-	return query, err
+	return pg.ParseContext(context.Background(), q, queryArgumentIndex)
 }
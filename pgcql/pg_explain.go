@@ -0,0 +1,169 @@
+package pgcql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CostGuard checks the plan of a statement, as estimated by EXPLAIN, against thresholds.
+// Thresholds of 0 are disabled.
+type CostGuard struct {
+	// MaxTotalCost is the maximum estimated total cost of the statement.
+	MaxTotalCost float64
+	// MaxRows is the maximum estimated number of rows returned by the statement.
+	MaxRows float64
+	// SeqScanTables are tables that must not be scanned sequentially, e.g. large tables.
+	// A name may be qualified with a schema, which is ignored.
+	SeqScanTables []string
+	// WarnOnly returns the report without an error when thresholds are exceeded.
+	WarnOnly bool
+}
+
+// PlanNode is a node of the plan returned by EXPLAIN (FORMAT JSON).
+type PlanNode struct {
+	NodeType     string     `json:"Node Type"`
+	RelationName string     `json:"Relation Name"`
+	Alias        string     `json:"Alias"`
+	TotalCost    float64    `json:"Total Cost"`
+	PlanRows     float64    `json:"Plan Rows"`
+	Plans        []PlanNode `json:"Plans"`
+}
+
+// CostViolationKind is the threshold exceeded by a plan.
+type CostViolationKind string
+
+const (
+	ViolationTotalCost CostViolationKind = "total cost"
+	ViolationRows      CostViolationKind = "rows"
+	ViolationSeqScan   CostViolationKind = "seq scan"
+)
+
+// CostViolation is a threshold exceeded by a plan. Relation is the table of a sequential scan.
+type CostViolation struct {
+	Kind     CostViolationKind
+	Relation string
+	Value    float64
+	Limit    float64
+}
+
+func (v CostViolation) String() string {
+	if v.Kind == ViolationSeqScan {
+		return "seq scan on " + v.Relation
+	}
+	return fmt.Sprintf("%s %s exceeds %s", v.Kind, formatCost(v.Value), formatCost(v.Limit))
+}
+
+func formatCost(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// CostReport is the outcome of checking a statement with a CostGuard.
+type CostReport struct {
+	SQL        string
+	TotalCost  float64
+	Rows       float64
+	SeqScans   []string // relations scanned sequentially, in plan order
+	Violations []CostViolation
+	Plan       *PlanNode
+}
+
+// Ok returns true if the plan is within all thresholds.
+func (r *CostReport) Ok() bool {
+	return len(r.Violations) == 0
+}
+
+// Message describes the violations, e.g. "total cost 1200 exceeds 1000; seq scan on mytable".
+func (r *CostReport) Message() string {
+	msgs := make([]string, len(r.Violations))
+	for i, v := range r.Violations {
+		msgs[i] = v.String()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// CostError is returned by a CostGuard when a statement exceeds its thresholds.
+type CostError struct {
+	Report *CostReport
+}
+
+func (e *CostError) Error() string {
+	return "query too expensive: " + e.Report.Message()
+}
+
+// Explain checks the statement consisting of selectClause, e.g. "SELECT id FROM mytable", followed by
+// the WHERE and ORDER BY clauses of the query. The query must be parsed with queryArgumentIndex 1.
+func (g *CostGuard) Explain(ctx context.Context, conn Querier, selectClause string, query Query) (*CostReport, error) {
+	sql := selectClause + " WHERE " + query.GetWhereClause() + query.GetOrderByClause()
+	return g.ExplainSQL(ctx, conn, sql, query.GetQueryArguments()...)
+}
+
+// ExplainSQL checks a statement with EXPLAIN (FORMAT JSON), which plans but does not execute it.
+// If a threshold is exceeded, the report is returned with a *CostError unless WarnOnly is set.
+func (g *CostGuard) ExplainSQL(ctx context.Context, conn Querier, sql string, args ...any) (*CostReport, error) {
+	rows, err := conn.Query(ctx, "EXPLAIN (FORMAT JSON) "+sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := pgx.CollectExactlyOneRow(rows, pgx.RowTo[[]byte])
+	if err != nil {
+		return nil, err
+	}
+	report, err := g.evaluate(plan)
+	if err != nil {
+		return nil, err
+	}
+	report.SQL = sql
+	if !report.Ok() && !g.WarnOnly {
+		return report, &CostError{Report: report}
+	}
+	return report, nil
+}
+
+// evaluate checks the JSON output of EXPLAIN against the thresholds.
+func (g *CostGuard) evaluate(plan []byte) (*CostReport, error) {
+	var explain []struct {
+		Plan PlanNode `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explain); err != nil {
+		return nil, &PgError{message: "invalid EXPLAIN output: " + err.Error()}
+	}
+	if len(explain) != 1 {
+		return nil, &PgError{message: "invalid EXPLAIN output: expected one plan"}
+	}
+	root := &explain[0].Plan
+	report := &CostReport{TotalCost: root.TotalCost, Rows: root.PlanRows, Plan: root}
+	if g.MaxTotalCost > 0 && root.TotalCost > g.MaxTotalCost {
+		report.Violations = append(report.Violations, CostViolation{Kind: ViolationTotalCost, Value: root.TotalCost, Limit: g.MaxTotalCost})
+	}
+	if g.MaxRows > 0 && root.PlanRows > g.MaxRows {
+		report.Violations = append(report.Violations, CostViolation{Kind: ViolationRows, Value: root.PlanRows, Limit: g.MaxRows})
+	}
+	g.checkNode(root, report)
+	return report, nil
+}
+
+func (g *CostGuard) checkNode(node *PlanNode, report *CostReport) {
+	if node.NodeType == "Seq Scan" {
+		report.SeqScans = append(report.SeqScans, node.RelationName)
+		if g.seqScanDenied(node.RelationName) {
+			report.Violations = append(report.Violations, CostViolation{Kind: ViolationSeqScan, Relation: node.RelationName})
+		}
+	}
+	for i := range node.Plans {
+		g.checkNode(&node.Plans[i], report)
+	}
+}
+
+func (g *CostGuard) seqScanDenied(relation string) bool {
+	for _, table := range g.SeqScanTables {
+		if strings.EqualFold(unqualified(table), relation) {
+			return true
+		}
+	}
+	return false
+}
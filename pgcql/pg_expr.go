@@ -0,0 +1,247 @@
+package pgcql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/indexdata/cql-go/cql"
+)
+
+// Expr is a node of the SQL expression tree generated from a CQL query.
+// The tree consists of Text, *Param, Seq, *Bool, *Not and *Paren nodes and is
+// turned into SQL text with numbered placeholders by RenderExpr.
+type Expr interface {
+	render(r *renderer)
+}
+
+// Text is a fragment of SQL without query arguments, e.g. a column and an operator.
+type Text string
+
+// Param is a query argument. A *Param occurring more than once in a tree is rendered
+// with the same placeholder and passed once, except with PlaceholderQuestion.
+type Param struct {
+	Value any
+}
+
+// Seq is a sequence of nodes rendered one after the other, e.g. a comparison of a column and a Param.
+type Seq []Expr
+
+// BoolOp is the operator of a Bool node.
+type BoolOp string
+
+const (
+	OpAnd BoolOp = "AND"
+	OpOr  BoolOp = "OR"
+)
+
+// Bool combines two expressions. Parentheses are not added, use Paren for that.
+type Bool struct {
+	Op    BoolOp
+	Left  Expr
+	Right Expr
+}
+
+// Not negates an expression.
+type Not struct {
+	Expr Expr
+}
+
+// Paren encloses an expression in parentheses.
+type Paren struct {
+	Expr Expr
+}
+
+// ExprField is implemented by fields that generate an expression tree for a search clause.
+// Fields that only implement Field are included in the tree by parsing the placeholders
+// of the SQL returned by Generate.
+type ExprField interface {
+	Field
+	GenerateExpr(sc cql.SearchClause) (Expr, error)
+}
+
+func (t Text) render(r *renderer) {
+	r.sb.WriteString(string(t))
+}
+
+func (p *Param) render(r *renderer) {
+	r.placeholder(p)
+}
+
+func (s Seq) render(r *renderer) {
+	for _, expr := range s {
+		expr.render(r)
+	}
+}
+
+func (b *Bool) render(r *renderer) {
+	b.Left.render(r)
+	r.sb.WriteString(" " + string(b.Op) + " ")
+	b.Right.render(r)
+}
+
+func (n *Not) render(r *renderer) {
+	r.sb.WriteString("NOT ")
+	n.Expr.render(r)
+}
+
+func (p *Paren) render(r *renderer) {
+	r.sb.WriteString("(")
+	p.Expr.render(r)
+	r.sb.WriteString(")")
+}
+
+// RenderExpr returns the SQL of an expression with placeholders numbered from queryArgumentIndex
+// and the query arguments in placeholder order.
+func RenderExpr(expr Expr, queryArgumentIndex int) (string, []any) {
+	r := newRenderer(RenderOptions{Index: queryArgumentIndex})
+	sql := r.render(expr)
+	return sql, r.args
+}
+
+// RenderExprWith returns the SQL of an expression with the placeholder style of opts, the positional
+// query arguments and, for PlaceholderNamed, the arguments by name.
+func RenderExprWith(expr Expr, opts RenderOptions) (string, []any, map[string]any) {
+	r := newRenderer(opts)
+	sql := r.render(expr)
+	return sql, r.args, r.named
+}
+
+// generateSQL implements Field.Generate for fields generating an expression tree.
+func generateSQL(field ExprField, sc cql.SearchClause, queryArgumentIndex int) (string, []any, error) {
+	expr, err := field.GenerateExpr(sc)
+	if err != nil {
+		return "", nil, err
+	}
+	sql, args := RenderExpr(expr, queryArgumentIndex)
+	return sql, args, nil
+}
+
+// generateExpr returns the expression tree of a search clause for any field.
+func generateExpr(field Field, sc cql.SearchClause) (Expr, error) {
+	if ef, ok := field.(ExprField); ok {
+		return ef.GenerateExpr(sc)
+	}
+	sql, args, err := field.Generate(sc, 1)
+	if err != nil {
+		return nil, err
+	}
+	return parseSQLExpr(sql, args, 1)
+}
+
+// parseSQLExpr splits SQL into Text and Param nodes at the placeholders $n referring to args,
+// where the first argument is $queryArgumentIndex. Placeholders in string literals, including escape
+// strings such as E'\'$1', quoted identifiers and dollar-quoted strings are ignored.
+// A placeholder without argument or an argument without placeholder is an error; the expression
+// is returned anyway with such placeholders as text.
+func parseSQLExpr(sql string, args []any, queryArgumentIndex int) (Expr, error) {
+	params := make([]*Param, len(args))
+	var seq Seq
+	var err error
+	start := 0
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		if c == '\'' || c == '"' {
+			escape := c == '\'' && i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i == 1 || !isIdentChar(sql[i-2]))
+			i = quotedEnd(sql, i, escape)
+			continue
+		}
+		if c != '$' || (i > 0 && isIdentChar(sql[i-1])) {
+			continue
+		}
+		j := i + 1
+		for j < len(sql) && sql[j] >= '0' && sql[j] <= '9' {
+			j++
+		}
+		if j == i+1 {
+			i = dollarQuotedEnd(sql, i)
+			continue
+		}
+		n, convErr := strconv.Atoi(sql[i+1 : j])
+		if convErr != nil || n < queryArgumentIndex || n >= queryArgumentIndex+len(args) {
+			if err == nil {
+				err = &PgError{message: fmt.Sprintf("placeholder %s has no argument", sql[i:j])}
+			}
+			continue
+		}
+		if start < i {
+			seq = append(seq, Text(sql[start:i]))
+		}
+		k := n - queryArgumentIndex
+		if params[k] == nil {
+			params[k] = &Param{Value: args[k]}
+		}
+		seq = append(seq, params[k])
+		start = j
+		i = j - 1
+	}
+	if start < len(sql) {
+		seq = append(seq, Text(sql[start:]))
+	}
+	for k, param := range params {
+		if param == nil && err == nil {
+			err = &PgError{message: fmt.Sprintf("argument %d has no placeholder $%d", k+1, k+queryArgumentIndex)}
+		}
+	}
+	return seq, err
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// quotedEnd returns the index of the quote ending the literal or identifier starting at i.
+// In an escape string a backslash escapes the next character.
+func quotedEnd(sql string, i int, escape bool) int {
+	quote := sql[i]
+	for i++; i < len(sql); i++ {
+		if escape && sql[i] == '\\' {
+			i++
+		} else if sql[i] == quote {
+			return i
+		}
+	}
+	return len(sql)
+}
+
+// dollarQuotedEnd returns the index of the last character of the dollar-quoted string starting at i,
+// e.g. $$a$$ or $tag$a$tag$, or i if there is none. The character after i is not a digit.
+func dollarQuotedEnd(sql string, i int) int {
+	j := i + 1
+	for j < len(sql) && isIdentChar(sql[j]) {
+		j++
+	}
+	if j == len(sql) || sql[j] != '$' {
+		return i
+	}
+	tag := sql[i : j+1]
+	end := strings.Index(sql[j+1:], tag)
+	if end < 0 {
+		return len(sql)
+	}
+	return j + end + len(tag)
+}
+
+// firstParam returns the first Param of an expression or nil if it has none.
+func firstParam(expr Expr) *Param {
+	switch e := expr.(type) {
+	case *Param:
+		return e
+	case Seq:
+		for _, expr := range e {
+			if p := firstParam(expr); p != nil {
+				return p
+			}
+		}
+	case *Bool:
+		if p := firstParam(e.Left); p != nil {
+			return p
+		}
+		return firstParam(e.Right)
+	case *Not:
+		return firstParam(e.Expr)
+	case *Paren:
+		return firstParam(e.Expr)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package pgcql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/indexdata/cql-go/cql"
+	"github.com/jackc/pgx/v5"
+)
+
+// FacetKind describes how facet values are extracted from a column.
+type FacetKind int
+
+const (
+	FacetScalar     FacetKind = iota // one value per row
+	FacetArray                       // PostgreSQL array column, each element is a value
+	FacetJsonbArray                  // jsonb array column, each element is a value
+)
+
+type Facet struct {
+	column string
+	kind   FacetKind
+}
+
+func NewFacet() *Facet {
+	return &Facet{}
+}
+
+func (f *Facet) WithColumn(column string) *Facet {
+	f.column = column
+	return f
+}
+
+// WithArray treats the column as a PostgreSQL array and counts each element using unnest.
+func (f *Facet) WithArray() *Facet {
+	f.kind = FacetArray
+	return f
+}
+
+// WithJsonbArray treats the column as a jsonb array and counts each element using jsonb_array_elements_text.
+func (f *Facet) WithJsonbArray() *Facet {
+	f.kind = FacetJsonbArray
+	return f
+}
+
+func (f *Facet) GetColumn() string {
+	return f.column
+}
+
+func (f *Facet) GetKind() FacetKind {
+	return f.kind
+}
+
+// FacetQuery is a generated facet count statement with its arguments.
+type FacetQuery struct {
+	Name      string
+	SQL       string
+	Arguments []any
+	Version   string // version of the definition
+}
+
+type FacetBucket struct {
+	Value string
+	Count int64
+}
+
+type FacetResult struct {
+	Name    string
+	Buckets []FacetBucket
+}
+
+func (f *Facet) generate(from string, where string, args []any, limit int) (string, []any) {
+	var value, source string
+	switch f.kind {
+	case FacetArray:
+		value = "facet.value"
+		source = ", LATERAL unnest(" + f.column + ") AS facet(value)"
+	case FacetJsonbArray:
+		value = "facet.value"
+		source = ", LATERAL jsonb_array_elements_text(" + f.column + ") AS facet(value)"
+	default:
+		value = "(" + f.column + ")"
+	}
+	sql := "SELECT " + value + "::text AS value, count(*) AS count FROM " + from + source +
+		" WHERE (" + where + ") AND " + value + " IS NOT NULL" +
+		" GROUP BY 1 ORDER BY count DESC, value" +
+		fmt.Sprintf(" LIMIT $%d", len(args)+1)
+	facetArgs := make([]any, 0, len(args)+1)
+	facetArgs = append(facetArgs, args...)
+	facetArgs = append(facetArgs, limit)
+	return sql, facetArgs
+}
+
+// GenerateFacets returns a facet count statement for each of the named facets.
+// The statements select from the given FROM item (a table name, possibly with joins)
+// and are restricted by the CQL query and the scoping predicates for ctx. Sorting in the CQL query is ignored.
+// Arguments are numbered from $1 and the limit is passed as the last argument.
+func (pg *PgDefinition) GenerateFacets(ctx context.Context, q cql.Query, from string, facets []string, limit int) ([]FacetQuery, error) {
+	scope, err := pg.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+	res, err := pg.parseContext(ctx, q, 1, scope)
+	if err != nil {
+		return nil, err
+	}
+	policy := PolicyFromContext(ctx)
+	queries := make([]FacetQuery, 0, len(facets))
+	for _, name := range facets {
+		if policy != nil && !policy.fieldAllowed(pg, name) {
+			return nil, &PermissionError{Reason: "facet " + name}
+		}
+		facet, ok := pg.facets[strings.ToLower(name)]
+		if !ok {
+			return nil, &PgError{message: fmt.Sprintf("unknown facet %s", name)}
+		}
+		if policy != nil && !policy.columnsAllowed(pg, []string{facet.GetColumn()}) {
+			return nil, &PermissionError{Reason: "facet " + name}
+		}
+		sql, args := facet.generate(from, res.GetWhereClause(), res.GetQueryArguments(), limit)
+		queries = append(queries, FacetQuery{Name: name, SQL: sql, Arguments: args, Version: pg.version})
+	}
+	return queries, nil
+}
+
+// GetFacets generates facet count statements for the CQL query and executes them.
+// The buckets of each facet are ordered by descending count.
+func GetFacets(ctx context.Context, conn Querier, def *PgDefinition, q cql.Query, from string, facets []string, limit int) ([]FacetResult, error) {
+	queries, err := def.GenerateFacets(ctx, q, from, facets, limit)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]FacetResult, 0, len(queries))
+	for _, fq := range queries {
+		rows, err := conn.Query(ctx, fq.SQL, fq.Arguments...)
+		if err != nil {
+			return nil, err
+		}
+		buckets, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (FacetBucket, error) {
+			var b FacetBucket
+			err := row.Scan(&b.Value, &b.Count)
+			return b, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, FacetResult{Name: fq.Name, Buckets: buckets})
+	}
+	return results, nil
+}
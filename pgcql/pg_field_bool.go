@@ -20,26 +20,54 @@ func (f *FieldBool) WithColumn(column string) *FieldBool {
 	return f
 }
 
+// WithNullPolicy sets how NULL values are treated by <> and NOT, overriding the policy of the definition.
+func (f *FieldBool) WithNullPolicy(policy NullPolicy) *FieldBool {
+	f.setNullPolicy(policy)
+	return f
+}
+
 func (f *FieldBool) Generate(sc cql.SearchClause, queryArgumentIndex int) (string, []any, error) {
-	s := f.handleEmptyTerm(sc)
-	if s != "" {
-		return s, []any{}, nil
+	return generateSQL(f, sc, queryArgumentIndex)
+}
+
+func (f *FieldBool) GenerateExpr(sc cql.SearchClause) (Expr, error) {
+	if expr := f.handleEmptyTerm(sc); expr != nil {
+		return expr, nil
+	}
+	if isArrayRelation(sc) {
+		terms := strings.Fields(sc.Term)
+		if len(terms) == 0 {
+			return nil, &PgError{message: fmt.Sprintf("invalid bool %s", sc.Term)}
+		}
+		values := make([]bool, len(terms))
+		for i, term := range terms {
+			boolValue, err := parseBool(term)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = boolValue
+		}
+		return f.generateArray(sc, values, "boolean")
 	}
 	relOrdered, err := f.handleUnorderedRelation(sc)
 	if err != nil {
-		return "", nil, err
+		return nil, err
+	}
+	boolValue, err := parseBool(sc.Term)
+	if err != nil {
+		return nil, err
 	}
+	return Seq{Text(f.column + " " + relOrdered + " "), &Param{Value: boolValue}}, nil
+}
 
-	// Map string values to boolean
-	var boolValue bool
-	switch strings.ToLower(sc.Term) {
+// parseBool maps string values to boolean
+func parseBool(term string) (bool, error) {
+	switch strings.ToLower(term) {
 	case "true", "1", "yes", "on":
-		boolValue = true
+		return true, nil
 	case "false", "0", "no", "off":
-		boolValue = false
+		return false, nil
 	default:
-		return "", nil, &PgError{message: fmt.Sprintf("invalid bool %s", sc.Term)}
+		return false, &PgError{message: fmt.Sprintf("invalid bool %s", term)}
 	}
-
-	return f.column + " " + relOrdered + fmt.Sprintf(" $%d", queryArgumentIndex), []any{boolValue}, nil
 }
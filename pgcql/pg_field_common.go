@@ -1,11 +1,16 @@
 package pgcql
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/indexdata/cql-go/cql"
 )
 
 type FieldCommon struct {
-	column string
+	column        string
+	nullPolicy    NullPolicy
+	nullPolicySet bool
 }
 
 func (f *FieldCommon) GetColumn() string {
@@ -24,7 +29,7 @@ func (f *FieldCommon) handleUnorderedRelation(sc cql.SearchClause) (string, erro
 	case "==", cql.EXACT, cql.EQ:
 		return "=", nil
 	case cql.NE:
-		return "<>", nil
+		return f.notEqualOp(), nil
 	default:
 		return "", &PgError{message: "unsupported relation " + string(sc.Relation)}
 	}
@@ -34,16 +39,65 @@ func (f *FieldCommon) handleOrderedRelation(sc cql.SearchClause) (string, error)
 	switch sc.Relation {
 	case "==", cql.EXACT:
 		return "=", nil
-	case "=", "<>", ">", "<", "<=", ">=":
+	case "<>":
+		return f.notEqualOp(), nil
+	case "=", ">", "<", "<=", ">=":
 		return string(sc.Relation), nil
 	default:
 		return "", &PgError{message: "unsupported relation " + string(sc.Relation)}
 	}
 }
 
-func (f *FieldCommon) handleEmptyTerm(sc cql.SearchClause) string {
-	if sc.Term == "" && sc.Relation == cql.EQ {
-		return f.column + " IS NOT NULL"
+// handleEmptyTerm returns IS NOT NULL for `= ""` and IS NULL for `=/missing ""`, regardless of the null policy.
+// `<> ""` is compared like any other term.
+func (f *FieldCommon) handleEmptyTerm(sc cql.SearchClause) Expr {
+	if sc.Term != "" || sc.Relation != cql.EQ {
+		return nil
+	}
+	if hasModifier(sc, Missing) {
+		return Text(f.column + " IS NULL")
+	}
+	return Text(f.column + " IS NOT NULL")
+}
+
+func hasModifier(sc cql.SearchClause, name cql.CqlModifier) bool {
+	for _, modifier := range sc.Modifiers {
+		if strings.EqualFold(modifier.Name, string(name)) || strings.EqualFold(modifier.Name, "cql."+string(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitRangeTerm splits a term such as "1990 2000" into its lower and upper value.
+func splitRangeTerm(term string) (string, string, error) {
+	values := strings.Fields(term)
+	if len(values) != 2 {
+		return "", "", &PgError{message: fmt.Sprintf("invalid range %s, it should be two values separated by space", term)}
 	}
-	return ""
+	return values[0], values[1], nil
+}
+
+// generateArray compares the column with a single array argument: = ANY for the any relation,
+// = ALL for all and <> ALL for <>. pgType is the element type of the array.
+func (f *FieldCommon) generateArray(sc cql.SearchClause, list any, pgType string) (Expr, error) {
+	var pgOp string
+	switch sc.Relation {
+	case cql.ANY:
+		pgOp = "= ANY"
+	case cql.ALL:
+		pgOp = "= ALL"
+	case cql.NE:
+		pgOp = "<> ALL"
+	default:
+		return nil, &PgError{message: "unsupported relation " + string(sc.Relation)}
+	}
+	return f.orNull(sc, Seq{Text(f.column + " " + pgOp + "("), &Param{Value: list}, Text("::" + pgType + "[])")}), nil
+}
+
+// isArrayRelation returns true for relations with a list of values as term:
+// any, all and <> with more than one value.
+func isArrayRelation(sc cql.SearchClause) bool {
+	return sc.Relation == cql.ANY || sc.Relation == cql.ALL ||
+		(sc.Relation == cql.NE && len(strings.Fields(sc.Term)) > 1)
 }
@@ -2,6 +2,9 @@ package pgcql
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/indexdata/cql-go/cql"
@@ -9,14 +12,30 @@ import (
 
 const dateFormat = "2006-01-02"
 const dateTimeFormat = "2006-01-02 15:04:05"
+const yearFormat = "2006"
+const yearMonthFormat = "2006-01"
 
+var relativeDate = regexp.MustCompile(`^(?i:(now|today))(?:([+-])(\d+)([smhdwMy]))?$`)
+var isoWeekDate = regexp.MustCompile(`^(\d{4})-?W(\d{2})(?:-?([1-7]))?$`)
+
+// FieldDateTime is a field for date and timestamp columns.
+// Lists of values for any, all and <> are passed as a date[] or timestamptz[] argument.
 type FieldDateTime struct {
 	FieldCommon
-	isDate bool
+	isDate   bool
+	location *time.Location
+	now      func() time.Time
+}
+
+// dateValue is a parsed date term. Terms with reduced precision, e.g. a year,
+// cover the half-open period [start, end). For other terms end is zero.
+type dateValue struct {
+	start time.Time
+	end   time.Time
 }
 
 func NewFieldDate() *FieldDateTime {
-	return &FieldDateTime{}
+	return &FieldDateTime{location: time.UTC, now: time.Now}
 }
 
 func (f *FieldDateTime) WithColumn(column string) *FieldDateTime {
@@ -24,52 +43,246 @@ func (f *FieldDateTime) WithColumn(column string) *FieldDateTime {
 	return f
 }
 
+// WithNullPolicy sets how NULL values are treated by <> and NOT, overriding the policy of the definition.
+func (f *FieldDateTime) WithNullPolicy(policy NullPolicy) *FieldDateTime {
+	f.setNullPolicy(policy)
+	return f
+}
+
 func (f *FieldDateTime) WithOnlyDate() *FieldDateTime {
 	f.isDate = true
 	return f
 }
 
+// WithLocation sets the time zone for terms without a zone offset, and for now and today. Default is UTC.
+func (f *FieldDateTime) WithLocation(location *time.Location) *FieldDateTime {
+	f.location = location
+	return f
+}
+
 func (f *FieldDateTime) Generate(sc cql.SearchClause, queryArgumentIndex int) (string, []any, error) {
-	s := f.handleEmptyTerm(sc)
-	if s != "" {
-		return s, []any{}, nil
+	return generateSQL(f, sc, queryArgumentIndex)
+}
+
+func (f *FieldDateTime) GenerateExpr(sc cql.SearchClause) (Expr, error) {
+	if expr := f.handleEmptyTerm(sc); expr != nil {
+		return expr, nil
+	}
+	if sc.Relation == cql.WITHIN {
+		return f.generateWithin(sc)
+	}
+	if isArrayRelation(sc) {
+		// a date time with space, e.g. "2026-03-05 09:34:27", is a single value for <>
+		if _, err := f.parseValue(sc.Term, false); err != nil || sc.Relation != cql.NE {
+			return f.generateList(sc)
+		}
 	}
 	relOrdered, err := f.handleOrderedRelation(sc)
 	if err != nil {
-		return "", nil, err
+		return nil, err
+	}
+	value, err := f.parseValue(sc.Term, hasModifier(sc, cql.IsoDate))
+	if err != nil {
+		return nil, err
+	}
+	if value.end.IsZero() {
+		return f.compare(relOrdered, value.start), nil
+	}
+	switch relOrdered {
+	case "=":
+		return f.period(value.start, value.end), nil
+	case f.notEqualOp():
+		expr := &Bool{Op: OpOr, Left: f.compare("<", value.start), Right: f.compare(">=", value.end)}
+		if f.nullPolicy != NullSQL {
+			expr = &Bool{Op: OpOr, Left: expr, Right: Text(f.column + " IS NULL")}
+		}
+		return &Paren{Expr: expr}, nil
+	case ">":
+		return f.compare(">=", value.end), nil
+	case "<=":
+		return f.compare("<", value.end), nil
+	default:
+		return f.compare(relOrdered, value.start), nil
+	}
+}
+
+func (f *FieldDateTime) compare(pgOp string, value time.Time) Expr {
+	return Seq{Text(f.column + " " + pgOp + " "), &Param{Value: value}}
+}
+
+// period matches the half-open period [start, end).
+func (f *FieldDateTime) period(start time.Time, end time.Time) Expr {
+	return &Paren{Expr: &Bool{Op: OpAnd, Left: f.compare(">=", start), Right: f.compare("<", end)}}
+}
+
+func (f *FieldDateTime) generateWithin(sc cql.SearchClause) (Expr, error) {
+	lower, upper, err := splitRangeTerm(sc.Term)
+	if err != nil {
+		return nil, err
 	}
-	number, err := f.parseTerm(sc.Term)
+	isoDate := hasModifier(sc, cql.IsoDate)
+	lowerValue, err := f.parseValue(lower, isoDate)
 	if err != nil {
-		if f.isDate {
-			return "", nil, &PgError{message: fmt.Sprintf("invalid date %s, it should be in format YYYY-MM-DD", sc.Term)}
-		} else {
-			return "", nil, &PgError{message: fmt.Sprintf("invalid date time %s, it should be in format YYYY-MM-DD, YYYY-MM-DD HH:MM:SS, YYYY-MM-DDTHH:MM:SSZ, YYYY-MM-DDTHH:MM:SS±HH:MM", sc.Term)}
+		return nil, err
+	}
+	upperValue, err := f.parseValue(upper, isoDate)
+	if err != nil {
+		return nil, err
+	}
+	if !upperValue.end.IsZero() {
+		return f.period(lowerValue.start, upperValue.end), nil
+	}
+	return Seq{Text(f.column + " BETWEEN "), &Param{Value: lowerValue.start}, Text(" AND "), &Param{Value: upperValue.start}}, nil
+}
+
+func (f *FieldDateTime) generateList(sc cql.SearchClause) (Expr, error) {
+	terms := strings.Fields(sc.Term)
+	if len(terms) == 0 {
+		return nil, f.invalidTerm(sc.Term)
+	}
+	isoDate := hasModifier(sc, cql.IsoDate)
+	values := make([]time.Time, len(terms))
+	for i, term := range terms {
+		value, err := f.parseValue(term, isoDate)
+		if err != nil {
+			return nil, err
+		}
+		if !value.end.IsZero() {
+			return nil, &PgError{message: fmt.Sprintf("partial date %s unsupported in list", term)}
 		}
+		values[i] = value.start
 	}
-	return f.column + " " + relOrdered + fmt.Sprintf(" $%d", queryArgumentIndex), []any{number}, nil
+	pgType := "timestamptz"
+	if f.isDate {
+		pgType = "date"
+	}
+	return f.generateArray(sc, values, pgType)
+}
+
+// partialDateFormats are the formats accepted for both dates and date times.
+const partialDateFormats = "YYYY-MM, YYYY, YYYY-Www-D with isoDate, or relative such as today or now-7d"
+
+func (f *FieldDateTime) invalidTerm(term string) error {
+	if f.isDate {
+		return &PgError{message: fmt.Sprintf("invalid date %s, it should be in format YYYY-MM-DD, %s", term, partialDateFormats)}
+	}
+	return &PgError{message: fmt.Sprintf("invalid date time %s, it should be in format YYYY-MM-DD, YYYY-MM-DD HH:MM:SS, YYYY-MM-DDTHH:MM:SSZ, YYYY-MM-DDTHH:MM:SS±HH:MM, %s", term, partialDateFormats)}
 }
 
 func (f *FieldDateTime) parseTerm(term string) (time.Time, error) {
+	value, err := f.parseValue(term, false)
+	return value.start, err
+}
+
+// parseValue parses a full date or date time, a year (YYYY) or month (YYYY-MM), a relative
+// expression such as now, today or now-7d and, with isoDate, ISO 8601 week dates and times
+// with fractional seconds.
+func (f *FieldDateTime) parseValue(term string, isoDate bool) (dateValue, error) {
+	location := f.location
+	if location == nil {
+		location = time.UTC
+	}
+	if m := relativeDate.FindStringSubmatch(term); m != nil {
+		return f.parseRelative(m, location)
+	}
+	if isoDate {
+		if m := isoWeekDate.FindStringSubmatch(term); m != nil {
+			return f.parseWeekDate(term, m)
+		}
+	}
+	for _, layout := range []string{yearFormat, yearMonthFormat} {
+		t, err := time.ParseInLocation(layout, term, location)
+		if err == nil {
+			if f.isDate {
+				t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+			}
+			if layout == yearFormat {
+				return dateValue{start: t, end: t.AddDate(1, 0, 0)}, nil
+			}
+			return dateValue{start: t, end: t.AddDate(0, 1, 0)}, nil
+		}
+	}
 	if f.isDate {
 		date, err := time.Parse(dateFormat, term)
 		if err != nil {
-			return time.Time{}, err
+			return dateValue{}, f.invalidTerm(term)
+		}
+		return dateValue{start: date}, nil
+	}
+	layouts := []string{
+		dateFormat,
+		dateTimeFormat,
+		time.RFC3339,
+	}
+	if isoDate {
+		layouts = append(layouts, "2006-01-02T15:04:05.999999999", "2006-01-02T15:04", "2006-01-02 15:04:05.999999999")
+	}
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, term, location)
+		if err == nil {
+			return dateValue{start: t}, nil
+		}
+	}
+	return dateValue{}, f.invalidTerm(term)
+}
+
+func (f *FieldDateTime) parseRelative(m []string, location *time.Location) (dateValue, error) {
+	now := time.Now
+	if f.now != nil {
+		now = f.now
+	}
+	t := now().In(location)
+	if f.isDate || strings.EqualFold(m[1], "today") {
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+	}
+	if m[2] != "" {
+		n, err := strconv.Atoi(m[3])
+		if err != nil {
+			return dateValue{}, f.invalidTerm(m[0])
 		}
-		return date, nil
-	} else {
-		layouts := []string{
-			dateFormat,
-			dateTimeFormat,
-			time.RFC3339,
+		if m[2] == "-" {
+			n = -n
 		}
-		var err error
-		for _, layout := range layouts {
-			t, e := time.Parse(layout, term)
-			if e == nil {
-				return t, nil
-			}
-			err = e
+		switch m[4] {
+		case "y":
+			t = t.AddDate(n, 0, 0)
+		case "M":
+			t = t.AddDate(0, n, 0)
+		case "w":
+			t = t.AddDate(0, 0, 7*n)
+		case "d":
+			t = t.AddDate(0, 0, n)
+		case "h":
+			t = t.Add(time.Duration(n) * time.Hour)
+		case "m":
+			t = t.Add(time.Duration(n) * time.Minute)
+		case "s":
+			t = t.Add(time.Duration(n) * time.Second)
 		}
-		return time.Time{}, err
 	}
+	if f.isDate {
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return dateValue{start: t}, nil
+}
+
+// parseWeekDate parses an ISO 8601 week date, YYYY-Www or YYYY-Www-D. A week without day covers the whole week.
+func (f *FieldDateTime) parseWeekDate(term string, m []string) (dateValue, error) {
+	location := time.UTC
+	if !f.isDate && f.location != nil {
+		location = f.location
+	}
+	year, _ := strconv.Atoi(m[1])
+	week, _ := strconv.Atoi(m[2])
+	// January 4th is always in week 1
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, location)
+	monday := jan4.AddDate(0, 0, -((int(jan4.Weekday())+6)%7)+(week-1)*7)
+	if y, w := monday.ISOWeek(); y != year || w != week {
+		return dateValue{}, f.invalidTerm(term)
+	}
+	if m[3] == "" {
+		return dateValue{start: monday, end: monday.AddDate(0, 0, 7)}, nil
+	}
+	day, _ := strconv.Atoi(m[3])
+	return dateValue{start: monday.AddDate(0, 0, day-1)}, nil
 }
@@ -0,0 +1,114 @@
+package pgcql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/indexdata/cql-go/cql"
+)
+
+// AddFieldGroup declares a group of related fields of the same child table.
+// Search clauses on fields of a group that are combined by AND or OR, or that are operands
+// of the same chain of ANDs, must match the same child row and generate a single EXISTS subquery, e.g.
+// `contributor.name = smith and contributor.role = editor` becomes
+//
+//	EXISTS (SELECT 1 FROM contributor r1 WHERE r1.instance_id = instance.id AND (r1.name = $1 AND r1.role = $2))
+func (pg *PgDefinition) AddFieldGroup(group string, fields ...string) *PgDefinition {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	if pg.groups == nil {
+		pg.groups = make(map[string]string)
+	}
+	for _, name := range fields {
+		pg.groups[strings.ToLower(name)] = group
+	}
+	return pg
+}
+
+// clauseGroup returns the field group of the clause if all its search clauses are in the same group, otherwise "".
+// A NOT is never in a group, so that `a not b` matches records where no child row matches b, as it does without
+// a group, rather than records with a child row that matches a but not b.
+func (pg *PgDefinition) clauseGroup(clause cql.Clause) string {
+	if clause.SearchClause != nil {
+		return pg.groups[strings.ToLower(clause.SearchClause.Index)]
+	}
+	if clause.BoolClause != nil && clause.BoolClause.Operator != cql.NOT {
+		group := pg.clauseGroup(clause.BoolClause.Left)
+		if group != "" && group == pg.clauseGroup(clause.BoolClause.Right) {
+			return group
+		}
+	}
+	return ""
+}
+
+// groupField returns the related field that the search clauses of a group clause are generated against.
+func (pg *PgDefinition) groupField(clause cql.Clause, group string, related *FieldRelated) (*FieldRelated, error) {
+	if clause.BoolClause != nil {
+		related, err := pg.groupField(clause.BoolClause.Left, group, related)
+		if err != nil {
+			return nil, err
+		}
+		return pg.groupField(clause.BoolClause.Right, group, related)
+	}
+	index := clause.SearchClause.Index
+	fieldType := pg.fieldType(index)
+	if fieldType == nil {
+		return nil, &PgError{message: fmt.Sprintf("unknown field %s", index)}
+	}
+	field, ok := fieldType.(*FieldRelated)
+	if !ok || (related != nil && (field.table != related.table || field.alias != related.alias ||
+		field.foreignKey != related.foreignKey || field.parentKey != related.parentKey)) {
+		return nil, &PgError{message: fmt.Sprintf("field group %s must consist of related fields of the same table", group)}
+	}
+	if related == nil {
+		return field, nil
+	}
+	return related, nil
+}
+
+// andOperands returns the operands of a chain of ANDs, keeping clauses of a single group together.
+func (pg *PgDefinition) andOperands(clause cql.Clause) []cql.Clause {
+	if clause.BoolClause == nil || clause.BoolClause.Operator != cql.AND || pg.clauseGroup(clause) != "" {
+		return []cql.Clause{clause}
+	}
+	return append(pg.andOperands(clause.BoolClause.Left), pg.andOperands(clause.BoolClause.Right)...)
+}
+
+func andClause(operands []cql.Clause) cql.Clause {
+	clause := operands[0]
+	for _, operand := range operands[1:] {
+		clause = cql.Clause{BoolClause: &cql.BoolClause{Left: clause, Operator: cql.AND, Right: operand}}
+	}
+	return clause
+}
+
+// groupAndOperands rewrites a chain of ANDs so that operands of the same group are combined
+// into one clause placed at the first of them. It returns false if there is nothing to combine.
+func (pg *PgDefinition) groupAndOperands(clause cql.Clause) (cql.Clause, bool) {
+	if len(pg.groups) == 0 || clause.BoolClause == nil || clause.BoolClause.Operator != cql.AND {
+		return clause, false
+	}
+	operands := pg.andOperands(clause)
+	grouped := make(map[string][]cql.Clause)
+	combine := false
+	for _, operand := range operands {
+		if group := pg.clauseGroup(operand); group != "" {
+			grouped[group] = append(grouped[group], operand)
+			combine = combine || len(grouped[group]) > 1
+		}
+	}
+	if !combine {
+		return clause, false
+	}
+	result := make([]cql.Clause, 0, len(operands))
+	for _, operand := range operands {
+		group := pg.clauseGroup(operand)
+		if group == "" {
+			result = append(result, operand)
+		} else if members, ok := grouped[group]; ok {
+			result = append(result, andClause(members))
+			delete(grouped, group)
+		}
+	}
+	return andClause(result), true
+}
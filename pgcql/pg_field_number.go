@@ -1,14 +1,35 @@
 package pgcql
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/indexdata/cql-go/cql"
 )
 
+type numberKind int
+
+const (
+	numberFloat numberKind = iota
+	numberInteger
+	numberDecimal
+)
+
+var decimalNumber = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]{1,4})?$`)
+
 type FieldNumber struct {
 	FieldCommon
+	kind numberKind
+	// bounds are exact values, with the text shown in errors
+	min     *big.Rat
+	max     *big.Rat
+	minText string
+	maxText string
 }
 
 func NewFieldNumber() *FieldNumber {
@@ -20,18 +41,184 @@ func (f *FieldNumber) WithColumn(column string) *FieldNumber {
 	return f
 }
 
+// WithNullPolicy sets how NULL values are treated by <> and NOT, overriding the policy of the definition.
+func (f *FieldNumber) WithNullPolicy(policy NullPolicy) *FieldNumber {
+	f.setNullPolicy(policy)
+	return f
+}
+
+// WithInteger parses terms as exact 64-bit integers and passes them as int64.
+func (f *FieldNumber) WithInteger() *FieldNumber {
+	f.kind = numberInteger
+	return f
+}
+
+// WithDecimal parses terms as arbitrary-precision decimals and passes them as strings cast to numeric.
+func (f *FieldNumber) WithDecimal() *FieldNumber {
+	f.kind = numberDecimal
+	return f
+}
+
+// WithMinMax rejects terms less than min or greater than max. The bounds are the shortest decimals
+// representing min and max, e.g. exactly 0.1 for 0.1, so terms equal to a bound are accepted.
+// Use WithIntegerMinMax for integer bounds beyond 2^53.
+func (f *FieldNumber) WithMinMax(min float64, max float64) *FieldNumber {
+	f.minText = strconv.FormatFloat(min, 'f', -1, 64)
+	f.maxText = strconv.FormatFloat(max, 'f', -1, 64)
+	f.min, _ = new(big.Rat).SetString(f.minText)
+	f.max, _ = new(big.Rat).SetString(f.maxText)
+	return f
+}
+
+// WithIntegerMinMax rejects terms less than min or greater than max, with exact integer bounds.
+func (f *FieldNumber) WithIntegerMinMax(min int64, max int64) *FieldNumber {
+	f.minText = strconv.FormatInt(min, 10)
+	f.maxText = strconv.FormatInt(max, 10)
+	f.min = new(big.Rat).SetInt64(min)
+	f.max = new(big.Rat).SetInt64(max)
+	return f
+}
+
+func (f *FieldNumber) queryArg(value any) Expr {
+	if f.kind == numberDecimal {
+		return Seq{&Param{Value: value}, Text("::numeric")}
+	}
+	return &Param{Value: value}
+}
+
 func (f *FieldNumber) Generate(sc cql.SearchClause, queryArgumentIndex int) (string, []any, error) {
-	s := f.handleEmptyTerm(sc)
-	if s != "" {
-		return s, []any{}, nil
+	return generateSQL(f, sc, queryArgumentIndex)
+}
+
+func (f *FieldNumber) GenerateExpr(sc cql.SearchClause) (Expr, error) {
+	if expr := f.handleEmptyTerm(sc); expr != nil {
+		return expr, nil
+	}
+	if sc.Relation == cql.WITHIN {
+		return f.generateWithin(sc)
+	}
+	if isArrayRelation(sc) {
+		return f.generateList(sc)
 	}
 	relOrdered, err := f.handleOrderedRelation(sc)
 	if err != nil {
-		return "", nil, err
+		return nil, err
+	}
+	number, err := f.parseTerm(sc.Term)
+	if err != nil {
+		return nil, err
+	}
+	return Seq{Text(f.column + " " + relOrdered + " "), f.queryArg(number)}, nil
+}
+
+func (f *FieldNumber) generateWithin(sc cql.SearchClause) (Expr, error) {
+	lower, upper, err := splitRangeTerm(sc.Term)
+	if err != nil {
+		return nil, err
 	}
-	number, err := strconv.ParseFloat(sc.Term, 64)
+	lowerNumber, err := f.parseTerm(lower)
 	if err != nil {
-		return "", nil, &PgError{message: fmt.Sprintf("invalid number %s", sc.Term)}
+		return nil, err
+	}
+	upperNumber, err := f.parseTerm(upper)
+	if err != nil {
+		return nil, err
+	}
+	return Seq{Text(f.column + " BETWEEN "), f.queryArg(lowerNumber), Text(" AND "), f.queryArg(upperNumber)}, nil
+}
+
+func (f *FieldNumber) generateList(sc cql.SearchClause) (Expr, error) {
+	terms := strings.Fields(sc.Term)
+	if len(terms) == 0 {
+		return nil, &PgError{message: fmt.Sprintf("invalid number %s", sc.Term)}
+	}
+	var list any
+	var pgType string
+	switch f.kind {
+	case numberInteger:
+		numbers := make([]int64, len(terms))
+		for i, term := range terms {
+			number, err := f.parseTerm(term)
+			if err != nil {
+				return nil, err
+			}
+			numbers[i] = number.(int64)
+		}
+		list = numbers
+		pgType = "bigint"
+	case numberDecimal:
+		numbers := make([]string, len(terms))
+		for i, term := range terms {
+			number, err := f.parseTerm(term)
+			if err != nil {
+				return nil, err
+			}
+			numbers[i] = number.(string)
+		}
+		list = numbers
+		pgType = "numeric"
+	default:
+		numbers := make([]float64, len(terms))
+		for i, term := range terms {
+			number, err := f.parseTerm(term)
+			if err != nil {
+				return nil, err
+			}
+			numbers[i] = number.(float64)
+		}
+		list = numbers
+		pgType = "float8"
+	}
+	return f.generateArray(sc, list, pgType)
+}
+
+// parseTerm parses a term as float64, int64 or decimal string depending on the kind of field.
+func (f *FieldNumber) parseTerm(term string) (any, error) {
+	var number any
+	var value *big.Rat
+	switch f.kind {
+	case numberInteger:
+		i, err := strconv.ParseInt(term, 10, 64)
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, &PgError{message: fmt.Sprintf("number %s out of range for integer", term)}
+		}
+		if err != nil {
+			return nil, &PgError{message: fmt.Sprintf("invalid integer %s", term)}
+		}
+		number = i
+		value = new(big.Rat).SetInt64(i)
+	case numberDecimal:
+		if !decimalNumber.MatchString(term) {
+			return nil, &PgError{message: fmt.Sprintf("invalid number %s", term)}
+		}
+		number = term
+		if f.min != nil || f.max != nil {
+			var ok bool
+			value, ok = new(big.Rat).SetString(term)
+			if !ok {
+				return nil, &PgError{message: fmt.Sprintf("invalid number %s", term)}
+			}
+		}
+	default:
+		d, err := strconv.ParseFloat(term, 64)
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, &PgError{message: fmt.Sprintf("number %s out of range", term)}
+		}
+		if err != nil || math.IsNaN(d) || math.IsInf(d, 0) {
+			return nil, &PgError{message: fmt.Sprintf("invalid number %s", term)}
+		}
+		number = d
+		if f.min != nil || f.max != nil {
+			// compare the decimal of the term, not its binary approximation
+			var ok bool
+			if value, ok = new(big.Rat).SetString(term); !ok {
+				value = new(big.Rat).SetFloat64(d)
+			}
+		}
+	}
+	if (f.min != nil && value.Cmp(f.min) < 0) || (f.max != nil && value.Cmp(f.max) > 0) {
+		return nil, &PgError{message: fmt.Sprintf("number %s out of range, it should be between %s and %s",
+			term, f.minText, f.maxText)}
 	}
-	return f.column + " " + relOrdered + fmt.Sprintf(" $%d", queryArgumentIndex), []any{number}, nil
+	return number, nil
 }
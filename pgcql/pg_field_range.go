@@ -0,0 +1,168 @@
+package pgcql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/indexdata/cql-go/cql"
+)
+
+// RangeType is the PostgreSQL range type of a FieldRange column.
+type RangeType string
+
+const (
+	RangeInt4 RangeType = "int4range"
+	RangeInt8 RangeType = "int8range"
+	RangeNum  RangeType = "numrange"
+	RangeDate RangeType = "daterange"
+	RangeTs   RangeType = "tsrange"
+	RangeTsTz RangeType = "tstzrange"
+)
+
+// FieldRange is a field for PostgreSQL range columns.
+// A term is either a single value or a lower and upper value separated by space, e.g. "1990 2000",
+// which is taken as the inclusive range [1990,2000]. A single value is taken as the range [value,value].
+// A partial date covers its whole period, e.g. "2020 2021" is the range [2020-01-01,2022-01-01).
+// The = relation matches ranges containing a single value and equal ranges otherwise, within and encloses
+// map to <@ and @>, the partial modifier to overlap (&&) and ordered relations compare range bounds.
+type FieldRange struct {
+	FieldCommon
+	rangeType RangeType
+}
+
+func NewFieldRange(rangeType RangeType) *FieldRange {
+	return &FieldRange{rangeType: rangeType}
+}
+
+func (f *FieldRange) WithColumn(column string) *FieldRange {
+	f.column = column
+	return f
+}
+
+// WithNullPolicy sets how NULL values are treated by <> and NOT, overriding the policy of the definition.
+func (f *FieldRange) WithNullPolicy(policy NullPolicy) *FieldRange {
+	f.setNullPolicy(policy)
+	return f
+}
+
+// rangeValue is a parsed range term, where upper is exclusive for the end of a partial date.
+type rangeValue struct {
+	lower     any
+	upper     any
+	exclusive bool
+}
+
+// bounds returns the range bounds argument of the range constructor.
+func (v rangeValue) bounds() string {
+	if v.exclusive {
+		return "'[)'"
+	}
+	return "'[]'"
+}
+
+func (f *FieldRange) parseValue(term string) (rangeValue, error) {
+	switch f.rangeType {
+	case RangeInt4, RangeInt8:
+		number, err := strconv.ParseInt(term, 10, 64)
+		if err != nil {
+			return rangeValue{}, &PgError{message: fmt.Sprintf("invalid integer %s", term)}
+		}
+		return rangeValue{lower: number, upper: number}, nil
+	case RangeNum:
+		number, err := strconv.ParseFloat(term, 64)
+		if err != nil {
+			return rangeValue{}, &PgError{message: fmt.Sprintf("invalid number %s", term)}
+		}
+		return rangeValue{lower: number, upper: number}, nil
+	default:
+		dt := FieldDateTime{isDate: f.rangeType == RangeDate}
+		value, err := dt.parseValue(term, false)
+		if err != nil {
+			return rangeValue{}, dt.invalidTerm(term)
+		}
+		if !value.end.IsZero() {
+			return rangeValue{lower: value.start, upper: value.end, exclusive: true}, nil
+		}
+		return rangeValue{lower: value.start, upper: value.start}, nil
+	}
+}
+
+// parseRange returns the range of term and whether term is a single value.
+func (f *FieldRange) parseRange(term string) (rangeValue, bool, error) {
+	if len(strings.Fields(term)) == 1 {
+		value, err := f.parseValue(strings.TrimSpace(term))
+		return value, true, err
+	}
+	if value, err := f.parseValue(term); err == nil {
+		return value, true, nil
+	}
+	lower, upper, err := splitRangeTerm(term)
+	if err != nil {
+		return rangeValue{}, false, err
+	}
+	lowerValue, err := f.parseValue(lower)
+	if err != nil {
+		return rangeValue{}, false, err
+	}
+	upperValue, err := f.parseValue(upper)
+	if err != nil {
+		return rangeValue{}, false, err
+	}
+	return rangeValue{lower: lowerValue.lower, upper: upperValue.upper, exclusive: upperValue.exclusive}, false, nil
+}
+
+func (f *FieldRange) Generate(sc cql.SearchClause, queryArgumentIndex int) (string, []any, error) {
+	return generateSQL(f, sc, queryArgumentIndex)
+}
+
+func (f *FieldRange) GenerateExpr(sc cql.SearchClause) (Expr, error) {
+	if expr := f.handleEmptyTerm(sc); expr != nil {
+		return expr, nil
+	}
+	var pgOp string
+	partial := hasModifier(sc, cql.Partial)
+	switch sc.Relation {
+	case cql.EQ:
+		if partial {
+			pgOp = "&&"
+		}
+	case "==", cql.EXACT:
+		pgOp = "="
+	case cql.NE:
+		pgOp = f.notEqualOp()
+	case cql.WITHIN:
+		pgOp = "<@"
+		if partial {
+			pgOp = "&&"
+		}
+	case cql.ENCLOSES:
+		pgOp = "@>"
+		if partial {
+			pgOp = "&&"
+		}
+	case cql.LT:
+		pgOp = "<<"
+	case cql.GT:
+		pgOp = ">>"
+	case cql.LE:
+		pgOp = "&<"
+	case cql.GE:
+		pgOp = "&>"
+	default:
+		return nil, &PgError{message: "unsupported relation " + string(sc.Relation)}
+	}
+	value, single, err := f.parseRange(sc.Term)
+	if err != nil {
+		return nil, err
+	}
+	if pgOp == "" {
+		if single {
+			pgOp = "@>"
+		} else {
+			pgOp = "="
+		}
+	}
+	return Seq{Text(f.column + " " + pgOp + " " + string(f.rangeType) + "("), &Param{Value: value.lower}, Text(", "),
+		&Param{Value: value.upper}, Text(", " + value.bounds() + ")")}, nil
+}
@@ -0,0 +1,139 @@
+package pgcql
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/indexdata/cql-go/cql"
+)
+
+var simpleIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// FieldRelated matches rows having at least one related row in a child table, e.g. holdings of an instance.
+// The search clause is generated by the inner field against the child table:
+//
+//	EXISTS (SELECT 1 FROM holdings r1 WHERE r1.instance_id = instance.id AND r1.barcode = $1)
+//
+// The alias of the child table is assigned by the definition, unless given by WithAlias.
+// A simple column name of the inner field is qualified with the alias; column expressions must use the alias themselves.
+type FieldRelated struct {
+	table       string
+	foreignKey  string
+	parentKey   string
+	alias       string
+	assigned    bool // the alias is assigned by a definition
+	innerColumn string
+	field       Field
+}
+
+// NewFieldRelated creates a field for the child table, where foreignKey is the column of the child table
+// referring to parentKey. parentKey should be qualified with the table name or alias of the main query, e.g. "instance.id".
+func NewFieldRelated(table string, foreignKey string, parentKey string, field Field) *FieldRelated {
+	return &FieldRelated{table: table, foreignKey: foreignKey, parentKey: parentKey, field: field}
+}
+
+// WithAlias sets the alias of the child table.
+func (f *FieldRelated) WithAlias(alias string) *FieldRelated {
+	f.setAlias(alias)
+	return f
+}
+
+func (f *FieldRelated) setAlias(alias string) {
+	f.alias = alias
+	if f.innerColumn == "" {
+		f.innerColumn = f.field.GetColumn()
+	}
+	if simpleIdentifier.MatchString(f.innerColumn) {
+		f.field.SetColumn(alias + "." + f.innerColumn)
+	}
+}
+
+// GetColumn returns an empty string as the column is not in the main table (no sorting, facets or scan on this field).
+func (f *FieldRelated) GetColumn() string {
+	return ""
+}
+
+// SetColumn sets the column of the inner field, unless it has one.
+func (f *FieldRelated) SetColumn(column string) {
+	if f.field.GetColumn() == "" {
+		f.field.SetColumn(column)
+	}
+}
+
+func (f *FieldRelated) Sort() string {
+	return ""
+}
+
+func (f *FieldRelated) GetTable() string {
+	return f.table
+}
+
+func (f *FieldRelated) GetAlias() string {
+	return f.alias
+}
+
+func (f *FieldRelated) defaultNullPolicy(policy NullPolicy) {
+	if nf, ok := f.field.(nullPolicyField); ok {
+		nf.defaultNullPolicy(policy)
+	}
+}
+
+func (f *FieldRelated) Generate(sc cql.SearchClause, queryArgumentIndex int) (string, []any, error) {
+	return generateSQL(f, sc, queryArgumentIndex)
+}
+
+func (f *FieldRelated) GenerateExpr(sc cql.SearchClause) (Expr, error) {
+	expr, err := generateExpr(f.field, sc)
+	if err != nil {
+		return nil, err
+	}
+	return f.exists(expr), nil
+}
+
+// exists returns the EXISTS subquery for the inner predicate.
+func (f *FieldRelated) exists(expr Expr) Expr {
+	from := f.table
+	ref := f.table
+	if f.alias != "" {
+		from += " " + f.alias
+		ref = f.alias
+	}
+	return Seq{Text(fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s.%s = %s AND ", from, ref, f.foreignKey, f.parentKey)), expr, Text(")")}
+}
+
+// relatedField is implemented by fields that need an alias for a child table.
+type relatedField interface {
+	assignAliases(alias func(table string) string)
+	// clearAliases removes the aliases assigned by a definition, so that another definition can assign its own.
+	clearAliases()
+}
+
+func (f *FieldRelated) assignAliases(alias func(table string) string) {
+	if f.alias == "" {
+		f.setAlias(alias(f.table))
+		f.assigned = true
+	}
+}
+
+func (f *FieldRelated) clearAliases() {
+	if f.assigned {
+		f.alias = ""
+		f.assigned = false
+	}
+}
+
+func (f *FieldCombo) assignAliases(alias func(table string) string) {
+	for _, field := range f.fields {
+		if rf, ok := field.(relatedField); ok {
+			rf.assignAliases(alias)
+		}
+	}
+}
+
+func (f *FieldCombo) clearAliases() {
+	for _, field := range f.fields {
+		if rf, ok := field.(relatedField); ok {
+			rf.clearAliases()
+		}
+	}
+}
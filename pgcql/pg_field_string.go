@@ -2,11 +2,20 @@ package pgcql
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/indexdata/cql-go/cql"
 )
 
+// Phonetic is a fuzzystrmatch function used for =/phonetic matching.
+type Phonetic string
+
+const (
+	PhoneticDMetaphone Phonetic = "dmetaphone"
+	PhoneticSoundex    Phonetic = "soundex"
+)
+
 type FieldString struct {
 	FieldCommon
 	language        string
@@ -18,6 +27,11 @@ type FieldString struct {
 	enableSplit     bool
 	prefixMatchOnly bool
 	serverChoiceRel cql.Relation
+	enableFuzzy     bool
+	fuzzyThreshold  float64
+	fuzzyRank       bool
+	phonetic        Phonetic
+	trigramIndex    bool
 }
 
 func NewFieldString() *FieldString {
@@ -98,18 +112,69 @@ func (f *FieldString) WithLower() *FieldString {
 	return f
 }
 
+// WithFuzzy enables =/fuzzy matching using pg_trgm.
+// With a threshold of 0 the % operator is used, which honors pg_trgm.similarity_threshold and can use a trigram index.
+// Otherwise similarity() of column and term must be greater than threshold.
+func (f *FieldString) WithFuzzy(threshold float64) *FieldString {
+	f.enableFuzzy = true
+	f.fuzzyThreshold = threshold
+	return f
+}
+
+// WithFuzzyRank orders results by trigram similarity to the term for =/fuzzy and =/phonetic searches
+// that are not negated by NOT. The ranking follows any sort keys given in the query and is not included
+// in the order by fields. Ranking uses the pg_trgm extension, also for =/phonetic.
+func (f *FieldString) WithFuzzyRank() *FieldString {
+	f.fuzzyRank = true
+	return f
+}
+
+// WithPhonetic enables =/phonetic matching using the given fuzzystrmatch function.
+func (f *FieldString) WithPhonetic(algorithm Phonetic) *FieldString {
+	f.phonetic = algorithm
+	return f
+}
+
+// WithNullPolicy sets how NULL values are treated by <> and NOT, overriding the policy of the definition.
+func (f *FieldString) WithNullPolicy(policy NullPolicy) *FieldString {
+	f.setNullPolicy(policy)
+	return f
+}
+
+// getValueColumn returns the column, or the column with NULL replaced by an empty string for NullEmpty.
+func (f *FieldString) getValueColumn() string {
+	if f.nullPolicy == NullEmpty {
+		return "COALESCE(" + f.column + ", '')"
+	}
+	return f.column
+}
+
+// orNull makes a negated comparison also match NULL. With NullEmpty NULL is already compared as an empty string.
+func (f *FieldString) orNull(sc cql.SearchClause, expr Expr) Expr {
+	if f.nullPolicy == NullEmpty {
+		return expr
+	}
+	return f.FieldCommon.orNull(sc, expr)
+}
+
+// WithTrigramIndex declares that the column has a pg_trgm index, which can be used for leading wildcards.
+func (f *FieldString) WithTrigramIndex() *FieldString {
+	f.trigramIndex = true
+	return f
+}
+
 func (f *FieldString) getQueryColumn() string {
 	if f.enableLower {
-		return "lower(" + f.column + ")"
+		return "lower(" + f.getValueColumn() + ")"
 	}
-	return f.column
+	return f.getValueColumn()
 }
 
-func (f *FieldString) getQueryArg(index int) string {
+func (f *FieldString) queryArg(value string) Expr {
 	if f.enableLower {
-		return "lower(" + fmt.Sprintf("$%d", index) + ")"
+		return Seq{Text("lower("), &Param{Value: value}, Text(")")}
 	}
-	return fmt.Sprintf("$%d", index)
+	return &Param{Value: value}
 }
 
 func appendMaskedChar(pgTerm []rune, c rune) ([]rune, error) {
@@ -301,10 +366,10 @@ func maskedLike(cqlTerm string, prefixMatchOnly bool) (string, bool, error) {
 	return string(pgTerm), ops, nil
 }
 
-func (f *FieldString) generateTsQuery(sc cql.SearchClause, termOp string, queryArgumentIndex int) (string, []any, error) {
+func (f *FieldString) generateTsQuery(sc cql.SearchClause, termOp string) (Expr, error) {
 	pgTerms, err := maskedSplitTsTerms(sc.Term, " ")
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 	sql := ""
 	if f.assumeTsVector {
@@ -312,36 +377,106 @@ func (f *FieldString) generateTsQuery(sc cql.SearchClause, termOp string, queryA
 	} else {
 		sql += "to_tsvector('" + f.language + "', " + f.column + ") "
 	}
-	sql += "@@ to_tsquery('" + f.language + "', " + fmt.Sprintf("$%d", queryArgumentIndex) + ")"
-	return sql, []any{strings.Join(pgTerms, termOp)}, nil
+	sql += "@@ to_tsquery('" + f.language + "', "
+	return Seq{Text(sql), &Param{Value: strings.Join(pgTerms, termOp)}, Text(")")}, nil
 }
 
-func (f *FieldString) generateIn(sc cql.SearchClause, queryArgumentIndex int, not bool) (string, []any, error) {
+func (f *FieldString) generateIn(sc cql.SearchClause, not bool) (Expr, error) {
 	pgTerms, err := maskedSplit(sc.Term, " ")
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 	sql := f.getQueryColumn()
 	if not {
 		sql += " NOT"
 	}
 	sql += " IN("
-	anyTerms := make([]any, len(pgTerms))
+	expr := Seq{Text(sql)}
 	for i, v := range pgTerms {
 		if i > 0 {
-			sql += ", "
+			expr = append(expr, Text(", "))
 		}
-		sql += f.getQueryArg(queryArgumentIndex + i)
-		anyTerms[i] = v
+		expr = append(expr, f.queryArg(v))
 	}
-	sql += ")"
-	return sql, anyTerms, nil
+	expr = append(expr, Text(")"))
+	return f.orNull(sc, expr), nil
+}
+
+func (f *FieldString) generateFuzzy(sc cql.SearchClause) (Expr, error) {
+	if !f.enableFuzzy {
+		return nil, &PgError{message: "unsupported modifier fuzzy"}
+	}
+	pgTerm, err := maskedExact(sc.Term)
+	if err != nil {
+		return nil, err
+	}
+	var expr Expr = Seq{Text(f.getValueColumn() + " % "), &Param{Value: pgTerm}}
+	if f.fuzzyThreshold > 0 {
+		expr = Seq{Text("similarity(" + f.getValueColumn() + ", "), &Param{Value: pgTerm},
+			Text(") > " + strconv.FormatFloat(f.fuzzyThreshold, 'f', -1, 64))}
+	}
+	switch sc.Relation {
+	case cql.EQ, cql.SCR, cql.ADJ:
+		return expr, nil
+	case cql.NE:
+		return f.orNull(sc, &Not{Expr: &Paren{Expr: expr}}), nil
+	default:
+		return nil, &PgError{message: "unsupported relation " + string(sc.Relation)}
+	}
+}
+
+func (f *FieldString) generatePhonetic(sc cql.SearchClause) (Expr, error) {
+	if f.phonetic == "" {
+		return nil, &PgError{message: "unsupported modifier phonetic"}
+	}
+	pgTerm, err := maskedExact(sc.Term)
+	if err != nil {
+		return nil, err
+	}
+	pgOp := "="
+	switch sc.Relation {
+	case cql.EQ, cql.SCR, cql.ADJ:
+	case cql.NE:
+		pgOp = f.notEqualOp()
+	default:
+		return nil, &PgError{message: "unsupported relation " + string(sc.Relation)}
+	}
+	fn := string(f.phonetic)
+	return Seq{Text(fn + "(" + f.getValueColumn() + ") " + pgOp + " " + fn + "("), &Param{Value: pgTerm}, Text(")")}, nil
+}
+
+func (f *FieldString) rank(sc cql.SearchClause, term *Param) Expr {
+	if !f.fuzzyRank || sc.Term == "" {
+		return nil
+	}
+	if sc.Relation != cql.EQ && sc.Relation != cql.SCR && sc.Relation != cql.ADJ {
+		return nil
+	}
+	if (f.enableFuzzy && hasModifier(sc, cql.Fuzzy)) || (f.phonetic != "" && hasModifier(sc, cql.Phonetic)) {
+		return Seq{Text("similarity(" + f.column + ", "), term, Text(")")}
+	}
+	return nil
 }
 
 func (f *FieldString) Generate(sc cql.SearchClause, queryArgumentIndex int) (string, []any, error) {
-	sql := f.handleEmptyTerm(sc)
-	if sql != "" {
-		return sql, nil, nil
+	return generateSQL(f, sc, queryArgumentIndex)
+}
+
+func (f *FieldString) GenerateExpr(sc cql.SearchClause) (Expr, error) {
+	if expr := f.handleEmptyTerm(sc); expr != nil {
+		return expr, nil
+	}
+	if sc.Term == "" && sc.Relation == cql.NE && f.nullPolicy != NullSQL {
+		// `<> ""` matches non-empty values under every policy, so NULL must not match
+		c := *f
+		c.nullPolicy = NullSQL
+		return c.GenerateExpr(sc)
+	}
+	if hasModifier(sc, cql.Fuzzy) {
+		return f.generateFuzzy(sc)
+	}
+	if hasModifier(sc, cql.Phonetic) {
+		return f.generatePhonetic(sc)
 	}
 	if f.serverChoiceRel != "" && (sc.Relation == cql.EQ || sc.Relation == cql.SCR) {
 		sc.Relation = f.serverChoiceRel
@@ -350,25 +485,25 @@ func (f *FieldString) Generate(sc cql.SearchClause, queryArgumentIndex int) (str
 	if fulltext {
 		switch sc.Relation {
 		case cql.ADJ, cql.EQ:
-			return f.generateTsQuery(sc, "<->", queryArgumentIndex)
+			return f.generateTsQuery(sc, "<->")
 		case cql.ALL:
-			return f.generateTsQuery(sc, "&", queryArgumentIndex)
+			return f.generateTsQuery(sc, "&")
 		case cql.ANY:
-			return f.generateTsQuery(sc, "|", queryArgumentIndex)
+			return f.generateTsQuery(sc, "|")
 		}
 	}
 	if f.enableSplit {
 		if sc.Relation == cql.ANY {
-			return f.generateIn(sc, queryArgumentIndex, false)
+			return f.generateIn(sc, false)
 		}
 		if sc.Relation == cql.NE {
-			return f.generateIn(sc, queryArgumentIndex, true)
+			return f.generateIn(sc, true)
 		}
 	}
 	if (f.enableLike || f.enableILike) && (sc.Relation == cql.EQ || sc.Relation == cql.EXACT || sc.Relation == cql.NE) {
 		pgTerm, ops, err := maskedLike(sc.Term, f.prefixMatchOnly)
 		if err != nil {
-			return "", nil, err
+			return nil, err
 		}
 		if !f.enableExact || ops {
 			pgOp := "LIKE"
@@ -382,21 +517,21 @@ func (f *FieldString) Generate(sc cql.SearchClause, queryArgumentIndex int) (str
 				}
 			}
 			if f.enableILike {
-				return f.column + " " + pgOp + fmt.Sprintf(" $%d", queryArgumentIndex), []any{pgTerm}, nil
+				return f.orNull(sc, Seq{Text(f.getValueColumn() + " " + pgOp + " "), &Param{Value: pgTerm}}), nil
 			}
-			return f.getQueryColumn() + " " + pgOp + " " + f.getQueryArg(queryArgumentIndex), []any{pgTerm}, nil
+			return f.orNull(sc, Seq{Text(f.getQueryColumn() + " " + pgOp + " "), f.queryArg(pgTerm)}), nil
 		}
 	}
 	if !f.enableExact {
-		return "", nil, &PgError{message: "unsupported relation " + string(sc.Relation)}
+		return nil, &PgError{message: "unsupported relation " + string(sc.Relation)}
 	}
 	pgTerm, err := maskedExact(sc.Term)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 	pgOp, err := f.handleUnorderedRelation(sc)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
-	return f.getQueryColumn() + " " + pgOp + " " + f.getQueryArg(queryArgumentIndex), []any{pgTerm}, nil
+	return Seq{Text(f.getQueryColumn() + " " + pgOp + " "), f.queryArg(pgTerm)}, nil
 }
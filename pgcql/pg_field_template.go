@@ -0,0 +1,138 @@
+package pgcql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/indexdata/cql-go/cql"
+)
+
+// TermType is the type of the terms of a FieldTemplate.
+type TermType int
+
+const (
+	TermString TermType = iota // the term with CQL masking removed, or as is with the unmasked modifier
+	TermNumber                 // a float64, e.g. 3.14
+	TermDate                   // a time.Time, e.g. 2024-01-31, 2024-01-31T12:00:00Z or now-7d, but not a partial date such as 2024
+	TermBool                   // a bool, e.g. true, yes, on, 1
+)
+
+// FieldTemplate is a field for expressions that do not fit the "column op $n" shape, given as SQL templates
+// per relation. In a template, {column} is replaced by the column of the field and {arg} by the placeholder
+// of the term, converted to the term type, e.g.
+//
+//	NewFieldTemplate(TermString).WithColumn("doc").WithTemplate(cql.EQ, "jsonb_path_exists({column}, {arg}::jsonpath)")
+//
+// Relations without a template are not supported. Templates must not contain placeholders such as $1.
+// The expression of a template is parenthesized, so it may use OR. Sorting requires a sort expression, see WithSort.
+type FieldTemplate struct {
+	FieldCommon
+	termType  TermType
+	templates map[cql.Relation]string
+	sort      string
+}
+
+func NewFieldTemplate(termType TermType) *FieldTemplate {
+	return &FieldTemplate{termType: termType}
+}
+
+func (f *FieldTemplate) WithColumn(column string) *FieldTemplate {
+	f.column = column
+	return f
+}
+
+// WithTemplate sets the SQL template of a relation, e.g. "coalesce({column}, title) = {arg}" for cql.EQ.
+func (f *FieldTemplate) WithTemplate(relation cql.Relation, template string) *FieldTemplate {
+	if f.templates == nil {
+		f.templates = make(map[cql.Relation]string)
+	}
+	f.templates[cql.Relation(strings.ToLower(string(relation)))] = template
+	return f
+}
+
+// WithSort sets the SQL expression used for sorting, where {column} is replaced by the column, e.g. "lower({column})".
+func (f *FieldTemplate) WithSort(sort string) *FieldTemplate {
+	f.sort = sort
+	return f
+}
+
+// Sort returns the sort expression or an empty string if sorting is not supported.
+func (f *FieldTemplate) Sort() string {
+	return strings.ReplaceAll(f.sort, "{column}", f.column)
+}
+
+func (f *FieldTemplate) Generate(sc cql.SearchClause, queryArgumentIndex int) (string, []any, error) {
+	return generateSQL(f, sc, queryArgumentIndex)
+}
+
+func (f *FieldTemplate) GenerateExpr(sc cql.SearchClause) (Expr, error) {
+	template, ok := f.templates[cql.Relation(strings.ToLower(string(sc.Relation)))]
+	if !ok {
+		return nil, &PgError{message: "unsupported relation " + string(sc.Relation)}
+	}
+	var term *Param
+	if strings.Contains(template, "{arg}") {
+		value, err := f.parseTerm(sc)
+		if err != nil {
+			return nil, err
+		}
+		term = &Param{Value: value}
+	}
+	// every {arg} refers to the same argument
+	var seq Seq
+	for i, part := range strings.Split(template, "{arg}") {
+		if i > 0 {
+			seq = append(seq, term)
+		}
+		if part != "" {
+			seq = append(seq, Text(strings.ReplaceAll(part, "{column}", f.column)))
+		}
+	}
+	return &Paren{Expr: seq}, nil
+}
+
+// parseTerm converts the term of the search clause to the term type.
+func (f *FieldTemplate) parseTerm(sc cql.SearchClause) (any, error) {
+	switch f.termType {
+	case TermNumber:
+		return (&FieldNumber{}).parseTerm(sc.Term)
+	case TermDate:
+		value, err := (&FieldDateTime{}).parseValue(sc.Term, false)
+		if err != nil {
+			return nil, err
+		}
+		// a template has a single argument, so a partial date cannot be matched as a period
+		if !value.end.IsZero() {
+			return nil, &PgError{message: fmt.Sprintf("partial date %s unsupported in template", sc.Term)}
+		}
+		return value.start, nil
+	case TermBool:
+		return parseBool(sc.Term)
+	}
+	if hasModifier(sc, cql.Unmasked) {
+		return sc.Term, nil
+	}
+	term, err := maskedExact(sc.Term)
+	if err != nil {
+		return nil, &PgError{message: err.Error()}
+	}
+	return term, nil
+}
+
+// indexKeys returns no index as the expressions of the templates are unknown.
+func (f *FieldTemplate) indexKeys() []indexKey {
+	return nil
+}
+
+// schemaColumns returns the column if a template or the sort expression refers to it.
+func (f *FieldTemplate) schemaColumns() []schemaColumn {
+	if strings.Contains(f.sort, "{column}") {
+		return []schemaColumn{{column: f.column}}
+	}
+	for _, template := range f.templates {
+		if strings.Contains(template, "{column}") {
+			return []schemaColumn{{column: f.column}}
+		}
+	}
+	return nil
+}
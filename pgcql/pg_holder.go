@@ -0,0 +1,149 @@
+package pgcql
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/indexdata/cql-go/cql"
+)
+
+// DefinitionHolder holds the current definition of a service, which can be replaced while queries
+// are generated, e.g. when the configuration is reloaded on SIGHUP. Each query is generated by a single
+// definition, the current one when generation starts, and carries its version.
+// The zero DefinitionHolder holds no definition, so it generates no queries until a definition is swapped in.
+type DefinitionHolder struct {
+	current atomic.Pointer[heldDefinition]
+	// mu orders swaps, so that the current definition is the one with the latest generation
+	mu         sync.Mutex
+	generation int64
+}
+
+// heldDefinition is a definition with the version of the holder, which is that of the definition if it has one.
+type heldDefinition struct {
+	def     *PgDefinition
+	version string
+}
+
+// NewDefinitionHolder returns a holder with def as the current definition.
+func NewDefinitionHolder(def *PgDefinition) *DefinitionHolder {
+	h := &DefinitionHolder{}
+	h.Swap(def)
+	return h
+}
+
+// load returns the current definition or an error if there is none.
+func (h *DefinitionHolder) load() (*heldDefinition, error) {
+	held := h.current.Load()
+	if held == nil || held.def == nil {
+		return nil, &PgError{message: "no definition"}
+	}
+	return held, nil
+}
+
+// Load returns the current definition, or nil if there is none. Changes to it are seen by concurrent queries,
+// so a definition that is changed in steps should be built or cloned and then swapped in.
+func (h *DefinitionHolder) Load() *PgDefinition {
+	if held := h.current.Load(); held != nil {
+		return held.def
+	}
+	return nil
+}
+
+// Version returns the version of the current definition, or an empty string if there is none.
+func (h *DefinitionHolder) Version() string {
+	if held := h.current.Load(); held != nil {
+		return held.version
+	}
+	return ""
+}
+
+// Swap makes def the current definition and returns the previous one. A definition without a version
+// is given the number of definitions held so far as version, e.g. "1" for the first; the definition itself
+// is not changed. Swapping in nil leaves the holder without a definition.
+func (h *DefinitionHolder) Swap(def *PgDefinition) *PgDefinition {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.generation++
+	held := &heldDefinition{def: def}
+	if def != nil {
+		held.version = def.GetVersion()
+		if held.version == "" {
+			held.version = strconv.FormatInt(h.generation, 10)
+		}
+	}
+	previous := h.current.Swap(held)
+	if previous == nil {
+		return nil
+	}
+	return previous.def
+}
+
+// Reload makes the definition returned by load the current one. If load fails, the current definition
+// is kept and the error is returned.
+func (h *DefinitionHolder) Reload(load func() (*PgDefinition, error)) error {
+	def, err := load()
+	if err != nil {
+		return err
+	}
+	if def == nil {
+		return &PgError{message: "no definition"}
+	}
+	h.Swap(def)
+	return nil
+}
+
+// Parse converts the query with the current definition, see PgDefinition.Parse.
+func (h *DefinitionHolder) Parse(q cql.Query, queryArgumentIndex int) (*PgQuery, error) {
+	return h.ParseContext(context.Background(), q, queryArgumentIndex)
+}
+
+// ParseContext converts the query with the current definition, see PgDefinition.ParseContext.
+func (h *DefinitionHolder) ParseContext(ctx context.Context, q cql.Query, queryArgumentIndex int) (*PgQuery, error) {
+	held, err := h.load()
+	if err != nil {
+		return nil, err
+	}
+	res, err := held.def.ParseContext(ctx, q, queryArgumentIndex)
+	if err != nil {
+		return nil, err
+	}
+	res.version = held.version
+	return res, nil
+}
+
+// GenerateFacets returns facet count statements of the current definition, see PgDefinition.GenerateFacets.
+func (h *DefinitionHolder) GenerateFacets(ctx context.Context, q cql.Query, from string, facets []string, limit int) ([]FacetQuery, error) {
+	held, err := h.load()
+	if err != nil {
+		return nil, err
+	}
+	queries, err := held.def.GenerateFacets(ctx, q, from, facets, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range queries {
+		queries[i].Version = held.version
+	}
+	return queries, nil
+}
+
+// GenerateScan returns scan statements of the current definition, see PgDefinition.GenerateScan.
+func (h *DefinitionHolder) GenerateScan(ctx context.Context, scanClause string, from string, responsePosition int, maximumTerms int) (*ScanQuery, error) {
+	held, err := h.load()
+	if err != nil {
+		return nil, err
+	}
+	scan, err := held.def.GenerateScan(ctx, scanClause, from, responsePosition, maximumTerms)
+	if err != nil {
+		return nil, err
+	}
+	scan.Version = held.version
+	for _, fq := range []*FacetQuery{scan.Before, scan.After} {
+		if fq != nil {
+			fq.Version = held.version
+		}
+	}
+	return scan, nil
+}
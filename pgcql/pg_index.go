@@ -0,0 +1,299 @@
+package pgcql
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// IndexRecommendation is an index that lets queries of the listed fields use an index scan.
+type IndexRecommendation struct {
+	Fields    []string // names of the fields using the index
+	Table     string
+	Method    string // access method, e.g. btree or gin
+	Key       string // key expression with operator class, e.g. "lower(title) text_pattern_ops"
+	Extension string // extension providing the operator class or function, e.g. pg_trgm
+}
+
+// DDL returns the CREATE INDEX statement of the recommendation. The index name is chosen by PostgreSQL.
+func (r IndexRecommendation) DDL() string {
+	return "CREATE INDEX ON " + r.Table + " USING " + r.Method + " (" + r.Key + ")"
+}
+
+// indexKey is an index used by a field. An empty table is the table of the column.
+type indexKey struct {
+	table     string
+	column    string
+	method    string
+	expr      string
+	opclass   string
+	extension string
+}
+
+// indexedField is implemented by fields that can use an index.
+type indexedField interface {
+	indexKeys() []indexKey
+}
+
+var functionCall = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\(.*\)$`)
+
+// key returns the key of the CREATE INDEX statement, where expressions other than columns
+// and function calls must be enclosed in parentheses.
+func (k indexKey) key() string {
+	key := k.expr
+	if !simpleIdentifier.MatchString(key) && !functionCall.MatchString(key) {
+		key = "(" + key + ")"
+	}
+	if k.opclass != "" {
+		key += " " + k.opclass
+	}
+	return key
+}
+
+func (f *FieldCommon) indexKeys() []indexKey {
+	return []indexKey{{column: f.column, method: "btree", expr: f.column}}
+}
+
+// indexKeys returns no index as a boolean column is rarely selective enough for an index scan.
+func (f *FieldBool) indexKeys() []indexKey {
+	return nil
+}
+
+func (f *FieldRange) indexKeys() []indexKey {
+	return []indexKey{{column: f.column, method: "gist", expr: f.column}}
+}
+
+func (f *FieldString) indexKeys() []indexKey {
+	var keys []indexKey
+	add := func(method string, expr string, opclass string, extension string) {
+		key := indexKey{column: f.column, method: method, expr: expr, opclass: opclass, extension: extension}
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	if f.assumeTsVector {
+		add("gin", f.column, "", "")
+	} else if f.language != "" {
+		add("gin", "to_tsvector('"+f.language+"', "+f.column+")", "", "")
+	}
+	if f.enableILike {
+		add("gin", f.getValueColumn(), "gin_trgm_ops", "pg_trgm")
+	}
+	if f.enableLike {
+		if f.trigramIndex {
+			add("gin", f.getQueryColumn(), "gin_trgm_ops", "pg_trgm")
+		} else {
+			add("btree", f.getQueryColumn(), "text_pattern_ops", "")
+		}
+	}
+	if (f.enableExact || f.enableSplit) && (!f.enableLike || f.trigramIndex) && !f.assumeTsVector {
+		add("btree", f.getQueryColumn(), "", "")
+	}
+	if f.enableFuzzy {
+		add("gin", f.getValueColumn(), "gin_trgm_ops", "pg_trgm")
+	}
+	if f.phonetic != "" {
+		add("btree", string(f.phonetic)+"("+f.getValueColumn()+")", "", "fuzzystrmatch")
+	}
+	return keys
+}
+
+func (f *FieldCombo) indexKeys() []indexKey {
+	var keys []indexKey
+	for _, field := range f.fields {
+		if inf, ok := field.(indexedField); ok {
+			keys = append(keys, inf.indexKeys()...)
+		}
+	}
+	return keys
+}
+
+// indexKeys returns the index of the foreign key and the indexes of the inner field on the child table.
+func (f *FieldRelated) indexKeys() []indexKey {
+	keys := []indexKey{{table: f.table, column: f.foreignKey, method: "btree", expr: f.foreignKey}}
+	if inf, ok := f.field.(indexedField); ok {
+		for _, key := range inf.indexKeys() {
+			key.table = f.table
+			if f.alias != "" {
+				key.expr = strings.ReplaceAll(key.expr, f.alias+".", "")
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// unqualified returns a table name without schema.
+func unqualified(table string) string {
+	if i := strings.LastIndexByte(table, '.'); i >= 0 {
+		return table[i+1:]
+	}
+	return table
+}
+
+var qualifiedColumn = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\.([A-Za-z_][A-Za-z0-9_]*)$`)
+
+// RecommendIndexes returns the indexes used by the queries of the fields. Columns of the fields are in table,
+// unless qualified with a table name, e.g. "publisher.name". Recommendations are ordered by table and key.
+func (pg *PgDefinition) RecommendIndexes(table string) []IndexRecommendation {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+	names := make([]string, 0, len(pg.fields))
+	for name := range pg.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var recommendations []IndexRecommendation
+	for _, name := range names {
+		inf, ok := pg.fieldNullPolicy(pg.fields[name]).(indexedField)
+		if !ok {
+			continue
+		}
+		for _, key := range inf.indexKeys() {
+			if key.table == "" {
+				key.table = table
+				if m := qualifiedColumn.FindStringSubmatch(key.column); m != nil {
+					key.table = m[1]
+					key.expr = strings.ReplaceAll(key.expr, m[1]+".", "")
+				}
+			}
+			r := IndexRecommendation{Table: key.table, Method: key.method, Key: key.key(), Extension: key.extension}
+			i := slices.IndexFunc(recommendations, func(e IndexRecommendation) bool {
+				return e.Table == r.Table && e.Method == r.Method && e.Key == r.Key
+			})
+			if i < 0 {
+				r.Fields = []string{name}
+				recommendations = append(recommendations, r)
+			} else if !slices.Contains(recommendations[i].Fields, name) {
+				recommendations[i].Fields = append(recommendations[i].Fields, name)
+			}
+		}
+	}
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		if recommendations[i].Table != recommendations[j].Table {
+			return recommendations[i].Table < recommendations[j].Table
+		}
+		return recommendations[i].Key < recommendations[j].Key
+	})
+	return recommendations
+}
+
+var (
+	indexUsing = regexp.MustCompile(`(?i) USING (\w+) \(`)
+	typeCast   = regexp.MustCompile(`::("[^"]*"|character varying|double precision|timestamp with(out)? time zone|\w+)(\[\])?`)
+)
+
+// normalizeIndexKey removes casts, parentheses and space from a key expression, so that keys
+// written by PostgreSQL in pg_indexes compare equal to the recommended keys.
+func normalizeIndexKey(key string) string {
+	key = typeCast.ReplaceAllString(strings.ToLower(key), "")
+	key = strings.ReplaceAll(key, "varchar_pattern_ops", "text_pattern_ops")
+	key = strings.ReplaceAll(key, "gist_trgm_ops", "gin_trgm_ops")
+	return strings.Map(func(r rune) rune {
+		if r == '(' || r == ')' || r == ' ' {
+			return -1
+		}
+		return r
+	}, key)
+}
+
+// splitIndexDef returns the access method and the keys of an index definition from pg_indexes, e.g.
+// "CREATE INDEX t_idx ON public.t USING btree (lower(title), id)" gives btree and [lower(title) id].
+func splitIndexDef(indexdef string) (string, []string) {
+	loc := indexUsing.FindStringSubmatchIndex(indexdef)
+	if loc == nil {
+		return "", nil
+	}
+	method := strings.ToLower(indexdef[loc[2]:loc[3]])
+	var keys []string
+	depth := 0
+	quote := false
+	start := loc[1]
+	for i := start; i < len(indexdef); i++ {
+		c := indexdef[i]
+		if quote {
+			if c == '\'' {
+				quote = false
+			}
+			continue
+		}
+		switch c {
+		case '\'':
+			quote = true
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return method, append(keys, strings.TrimSpace(indexdef[start:i]))
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				keys = append(keys, strings.TrimSpace(indexdef[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return method, keys
+}
+
+// indexMatches returns true if the index can be used for the recommended key. A btree index
+// must have the key as its first column. A trigram GiST index may be used instead of GIN.
+func indexMatches(r IndexRecommendation, indexdef string) bool {
+	method, keys := splitIndexDef(indexdef)
+	if len(keys) == 0 {
+		return false
+	}
+	key := normalizeIndexKey(r.Key)
+	if method != r.Method && !(method == "gist" && r.Method == "gin" && strings.HasSuffix(key, "gin_trgm_ops")) {
+		return false
+	}
+	if method == "btree" {
+		keys = keys[:1]
+	}
+	for _, k := range keys {
+		if normalizeIndexKey(k) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckIndexes inspects pg_indexes and returns the recommended indexes, see RecommendIndexes,
+// that do not exist. The fields of the returned recommendations cannot use an index for some queries.
+func CheckIndexes(ctx context.Context, conn Querier, def *PgDefinition, table string) ([]IndexRecommendation, error) {
+	recommendations := def.RecommendIndexes(table)
+	var tables []string
+	for _, r := range recommendations {
+		name := unqualified(r.Table)
+		if !slices.Contains(tables, name) {
+			tables = append(tables, name)
+		}
+	}
+	rows, err := conn.Query(ctx, "SELECT tablename, indexdef FROM pg_indexes WHERE tablename = ANY($1)", tables)
+	if err != nil {
+		return nil, err
+	}
+	type index struct {
+		Tablename string
+		Indexdef  string
+	}
+	indexes, err := pgx.CollectRows(rows, pgx.RowToStructByPos[index])
+	if err != nil {
+		return nil, err
+	}
+	missing := make([]IndexRecommendation, 0)
+	for _, r := range recommendations {
+		name := unqualified(r.Table)
+		if !slices.ContainsFunc(indexes, func(idx index) bool {
+			return idx.Tablename == name && indexMatches(r, idx.Indexdef)
+		}) {
+			missing = append(missing, r)
+		}
+	}
+	return missing, nil
+}
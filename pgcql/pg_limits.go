@@ -0,0 +1,137 @@
+package pgcql
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/indexdata/cql-go/cql"
+)
+
+// Errors for queries exceeding Limits, wrapped in a PgError.
+var (
+	ErrMaxArguments    = errors.New("too many query arguments")
+	ErrMaxOrFanOut     = errors.New("too many alternatives")
+	ErrLeadingWildcard = errors.New("leading wildcard unsupported")
+)
+
+// Limits restricts the size of the SQL generated by a definition. Limits of 0 are disabled.
+type Limits struct {
+	// MaxArguments is the maximum number of query arguments, including the elements of lists passed as arrays.
+	MaxArguments int
+	// MaxOrFanOut is the maximum number of alternatives of an OR, including the ORs generated by combo fields.
+	MaxOrFanOut int
+	// DenyLeadingWildcard denies terms starting with * or ? for fields using LIKE or ILIKE,
+	// unless the column has a trigram index, see FieldString.WithTrigramIndex.
+	DenyLeadingWildcard bool
+}
+
+// WithLimits sets limits for the SQL generated from queries.
+func (pg *PgDefinition) WithLimits(limits Limits) *PgDefinition {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.limits = limits
+	return pg
+}
+
+// leadingWildcardAllowed returns false for fields where a leading wildcard cannot use an index.
+func leadingWildcardAllowed(field Field) bool {
+	switch f := field.(type) {
+	case *FieldString:
+		return !(f.enableLike || f.enableILike) || f.trigramIndex
+	case *FieldRelated:
+		return leadingWildcardAllowed(f.field)
+	case *FieldCombo:
+		for _, field := range f.fields {
+			if !leadingWildcardAllowed(field) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func hasLeadingWildcard(term string) bool {
+	return len(term) > 0 && (term[0] == '*' || term[0] == '?')
+}
+
+func (l *Limits) checkSearchClause(sc *cql.SearchClause, field Field) error {
+	if l.DenyLeadingWildcard && hasLeadingWildcard(sc.Term) && !leadingWildcardAllowed(field) {
+		return &PgError{message: fmt.Sprintf("%s: %s", ErrLeadingWildcard, sc.Index), err: ErrLeadingWildcard}
+	}
+	return nil
+}
+
+// orFanOut returns the largest number of alternatives of an OR in the expression.
+func orFanOut(expr Expr) int {
+	switch e := expr.(type) {
+	case Seq:
+		n := 0
+		for _, expr := range e {
+			n = max(n, orFanOut(expr))
+		}
+		return n
+	case *Bool:
+		if e.Op == OpOr {
+			return max(orOperands(e), orFanOut(e.Left), orFanOut(e.Right))
+		}
+		return max(orFanOut(e.Left), orFanOut(e.Right))
+	case *Not:
+		return orFanOut(e.Expr)
+	case *Paren:
+		return orFanOut(e.Expr)
+	}
+	return 0
+}
+
+// orOperands returns the number of operands of an OR, where nested ORs are alternatives too.
+func orOperands(expr Expr) int {
+	switch e := expr.(type) {
+	case *Bool:
+		if e.Op == OpOr {
+			return orOperands(e.Left) + orOperands(e.Right)
+		}
+	case *Paren:
+		return orOperands(e.Expr)
+	}
+	return 1
+}
+
+// countArguments returns the number of distinct Param nodes in the expression, counting each element
+// of a list argument, e.g. the array of an any clause.
+func countArguments(expr Expr, seen map[*Param]bool) int {
+	switch e := expr.(type) {
+	case *Param:
+		if seen[e] {
+			return 0
+		}
+		seen[e] = true
+		if v := reflect.ValueOf(e.Value); v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+			return v.Len()
+		}
+		return 1
+	case Seq:
+		n := 0
+		for _, expr := range e {
+			n += countArguments(expr, seen)
+		}
+		return n
+	case *Bool:
+		return countArguments(e.Left, seen) + countArguments(e.Right, seen)
+	case *Not:
+		return countArguments(e.Expr, seen)
+	case *Paren:
+		return countArguments(e.Expr, seen)
+	}
+	return 0
+}
+
+func (l *Limits) checkQuery(where Expr) error {
+	if l.MaxOrFanOut > 0 && orFanOut(where) > l.MaxOrFanOut {
+		return &PgError{message: fmt.Sprintf("%s, at most %d allowed", ErrMaxOrFanOut, l.MaxOrFanOut), err: ErrMaxOrFanOut}
+	}
+	if l.MaxArguments > 0 && countArguments(where, make(map[*Param]bool)) > l.MaxArguments {
+		return &PgError{message: fmt.Sprintf("%s, at most %d allowed", ErrMaxArguments, l.MaxArguments), err: ErrMaxArguments}
+	}
+	return nil
+}
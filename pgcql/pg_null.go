@@ -0,0 +1,84 @@
+package pgcql
+
+import (
+	"github.com/indexdata/cql-go/cql"
+)
+
+// NullPolicy controls how NULL columns are treated by the negations <> and NOT.
+//
+// With NullSQL, PostgreSQL's three-valued logic applies and a row with a NULL column
+// matches neither a clause nor its negation. With NullNonMatch, NULL never matches a clause
+// and therefore always matches its negation. NullEmpty treats NULL as an empty string for
+// string fields and is the same as NullNonMatch for other fields.
+//
+// Regardless of policy, `field = ""` matches rows where the column is not NULL, `field =/missing ""`
+// matches rows where it is NULL and `field <> ""` matches rows with a non-empty value.
+type NullPolicy int
+
+const (
+	NullSQL NullPolicy = iota
+	NullNonMatch
+	NullEmpty
+)
+
+// Missing is the relation modifier for rows where a field is missing: `field =/missing ""` becomes IS NULL.
+const Missing cql.CqlModifier = "missing"
+
+// nullPolicyField is implemented by fields that honor a NullPolicy.
+// The definition's policy is used for fields where no policy was set explicitly.
+type nullPolicyField interface {
+	defaultNullPolicy(policy NullPolicy)
+}
+
+// fieldNullPolicy returns the field with the policy of the definition for NULL values, unless set per field.
+// The policy is set on a copy, so a field may be added to definitions with different policies.
+func (pg *PgDefinition) fieldNullPolicy(field Field) Field {
+	if pg.nullPolicy == NullSQL {
+		return field
+	}
+	if _, ok := field.(nullPolicyField); !ok {
+		return field
+	}
+	cf, ok := field.(cloneableField)
+	if !ok {
+		return field
+	}
+	field = cf.clone()
+	field.(nullPolicyField).defaultNullPolicy(pg.nullPolicy)
+	return field
+}
+
+func (f *FieldCommon) setNullPolicy(policy NullPolicy) {
+	f.nullPolicy = policy
+	f.nullPolicySet = true
+}
+
+func (f *FieldCommon) defaultNullPolicy(policy NullPolicy) {
+	if !f.nullPolicySet {
+		f.nullPolicy = policy
+	}
+}
+
+func (f *FieldCombo) defaultNullPolicy(policy NullPolicy) {
+	for _, field := range f.fields {
+		if nf, ok := field.(nullPolicyField); ok {
+			nf.defaultNullPolicy(policy)
+		}
+	}
+}
+
+// notEqualOp returns the operator for the <> relation, which is NULL-safe unless policy is NullSQL.
+func (f *FieldCommon) notEqualOp() string {
+	if f.nullPolicy == NullSQL {
+		return "<>"
+	}
+	return "IS DISTINCT FROM"
+}
+
+// orNull makes a negated comparison also match NULL unless policy is NullSQL.
+func (f *FieldCommon) orNull(sc cql.SearchClause, expr Expr) Expr {
+	if f.nullPolicy == NullSQL || sc.Relation != cql.NE {
+		return expr
+	}
+	return &Paren{Expr: &Bool{Op: OpOr, Left: expr, Right: Text(f.column + " IS NULL")}}
+}
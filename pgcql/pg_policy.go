@@ -0,0 +1,249 @@
+package pgcql
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/indexdata/cql-go/cql"
+)
+
+// Policy restricts what a caller may use in a query. The zero Policy allows everything.
+// Field names, columns, relations and modifiers are compared case-insensitively. Field names are resolved
+// with the context sets of the definition, like indexes without prefix, so with the default context set dc
+// "ssn" names the field "dc.ssn".
+type Policy struct {
+	// AllowedFields, if not empty, are the only fields that may be searched, sorted, faceted or scanned.
+	AllowedFields []string
+	// DeniedFields may not be searched, sorted, faceted or scanned. Combo and related fields are also
+	// denied if an inner field uses the column of a denied field.
+	DeniedFields []string
+	// DeniedColumns may not be searched, sorted, faceted or scanned by any field, including the inner
+	// fields of combo and related fields. A column of a child table is given with the table name,
+	// e.g. "holdings.barcode".
+	DeniedColumns []string
+	// DeniedRelations may not be used in search clauses, e.g. cql.NE.
+	DeniedRelations []cql.Relation
+	// DeniedModifiers are relation modifiers that may not be used, e.g. "fuzzy". A modifier is
+	// also denied when given with a "cql." prefix.
+	DeniedModifiers []string
+	// DenyLeadingWildcard denies terms starting with the masking characters * or ?.
+	DenyLeadingWildcard bool
+	// PrefixWildcardOnly allows masking characters only at the end of a term, e.g. "comp*".
+	PrefixWildcardOnly bool
+	// DeniedSortFields may not be used as sort keys.
+	DeniedSortFields []string
+	// MaxClauses is the maximum number of search clauses, 0 for no limit.
+	MaxClauses int
+	// MaxDepth is the maximum nesting of boolean operators, 0 for no limit. A chain of the same
+	// operator is one level, e.g. `a and b and c` has depth 1 and `a and (b or c)` has depth 2.
+	MaxDepth int
+	// MaxSortKeys is the maximum number of sort keys, 0 for no limit.
+	MaxSortKeys int
+}
+
+// PermissionError is returned when a query is denied by a Policy.
+// Clause is the CQL of the offending search clause or sort key, empty when the query as a whole is denied.
+type PermissionError struct {
+	Clause string
+	Reason string
+}
+
+func (e *PermissionError) Error() string {
+	if e.Clause == "" {
+		return "permission denied: " + e.Reason
+	}
+	return "permission denied for " + e.Clause + ": " + e.Reason
+}
+
+type policyKey struct{}
+
+// WithPolicy returns a context with the policy for the caller, which is applied by ParseContext,
+// GenerateFacets and GenerateScan.
+func WithPolicy(ctx context.Context, policy *Policy) context.Context {
+	return context.WithValue(ctx, policyKey{}, policy)
+}
+
+// PolicyFromContext returns the policy of the context or nil if there is none.
+func PolicyFromContext(ctx context.Context) *Policy {
+	policy, _ := ctx.Value(policyKey{}).(*Policy)
+	return policy
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(e string) bool {
+		return strings.EqualFold(e, s)
+	})
+}
+
+// containsField returns true if the list has the field name. Names of the list are resolved like indexes
+// of a query without prefix declarations, e.g. "ssn" is the field "dc.ssn" with the default context set dc.
+func containsField(def *PgDefinition, list []string, name string) bool {
+	return slices.ContainsFunc(list, func(e string) bool {
+		if strings.EqualFold(e, name) {
+			return true
+		}
+		resolved, err := def.resolveIndex(e, nil)
+		return err == nil && strings.EqualFold(resolved, name)
+	})
+}
+
+// policyColumns returns the columns used by a field, including those of inner fields.
+// Columns of a child table are qualified with the table name.
+func policyColumns(field Field) []string {
+	switch f := field.(type) {
+	case *FieldCombo:
+		var columns []string
+		for _, inner := range f.fields {
+			columns = append(columns, policyColumns(inner)...)
+		}
+		return columns
+	case *FieldRelated:
+		column := f.innerColumn
+		if column == "" {
+			column = f.field.GetColumn()
+		}
+		if column == "" {
+			return nil
+		}
+		return []string{f.table + "." + column}
+	}
+	if column := field.GetColumn(); column != "" {
+		return []string{column}
+	}
+	return nil
+}
+
+// columnsAllowed returns false if a column is denied, either directly or by being the column of a denied field.
+func (p *Policy) columnsAllowed(def *PgDefinition, columns []string) bool {
+	for _, column := range columns {
+		if containsFold(p.DeniedColumns, column) {
+			return false
+		}
+		for _, name := range p.DeniedFields {
+			if resolved, err := def.resolveIndex(name, nil); err == nil {
+				name = resolved
+			}
+			if field, ok := def.fields[strings.ToLower(name)]; ok && containsFold(policyColumns(field), column) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p *Policy) fieldAllowed(def *PgDefinition, name string) bool {
+	if len(p.AllowedFields) > 0 && !containsField(def, p.AllowedFields, name) {
+		return false
+	}
+	if containsField(def, p.DeniedFields, name) {
+		return false
+	}
+	if field, ok := def.fields[strings.ToLower(name)]; ok {
+		return p.columnsAllowed(def, policyColumns(field))
+	}
+	return true
+}
+
+// checkWildcards checks the masking characters of a term. Masked characters, e.g. \*, are ignored.
+func (p *Policy) checkWildcards(term string) string {
+	if !p.DenyLeadingWildcard && !p.PrefixWildcardOnly {
+		return ""
+	}
+	wildcard := false
+	backslash := false
+	for i, c := range term {
+		if backslash {
+			backslash = false
+			if wildcard && p.PrefixWildcardOnly {
+				return "wildcard not at end of term"
+			}
+			continue
+		}
+		switch c {
+		case '\\':
+			backslash = true
+		case '*', '?':
+			if i == 0 {
+				return "leading wildcard"
+			}
+			wildcard = true
+		default:
+			if wildcard && p.PrefixWildcardOnly {
+				return "wildcard not at end of term"
+			}
+		}
+	}
+	return ""
+}
+
+func (p *Policy) checkSearchClause(def *PgDefinition, sc *cql.SearchClause) error {
+	reason := ""
+	if !p.fieldAllowed(def, sc.Index) {
+		reason = "field " + sc.Index
+	} else if slices.ContainsFunc(p.DeniedRelations, func(r cql.Relation) bool {
+		return strings.EqualFold(string(r), string(sc.Relation))
+	}) {
+		reason = "relation " + string(sc.Relation)
+	} else {
+		for _, modifier := range sc.Modifiers {
+			name := modifier.Name
+			if len(name) > 4 && strings.EqualFold(name[:4], "cql.") {
+				name = name[4:]
+			}
+			if containsFold(p.DeniedModifiers, name) {
+				reason = "modifier " + modifier.Name
+				break
+			}
+		}
+		if reason == "" {
+			reason = p.checkWildcards(sc.Term)
+		}
+	}
+	if reason != "" {
+		return &PermissionError{Clause: sc.String(), Reason: reason}
+	}
+	return nil
+}
+
+func (p *Policy) checkClause(def *PgDefinition, clause cql.Clause, depth int, operator cql.Operator, clauses *int) error {
+	if clause.SearchClause != nil {
+		*clauses++
+		if p.MaxClauses > 0 && *clauses > p.MaxClauses {
+			return &PermissionError{Reason: fmt.Sprintf("too many clauses, at most %d allowed", p.MaxClauses)}
+		}
+		return p.checkSearchClause(def, clause.SearchClause)
+	}
+	if clause.BoolClause != nil {
+		if clause.BoolClause.Operator != operator {
+			depth++
+		}
+		if p.MaxDepth > 0 && depth > p.MaxDepth {
+			return &PermissionError{Reason: fmt.Sprintf("query too deep, at most %d levels allowed", p.MaxDepth)}
+		}
+		err := p.checkClause(def, clause.BoolClause.Left, depth, clause.BoolClause.Operator, clauses)
+		if err != nil {
+			return err
+		}
+		return p.checkClause(def, clause.BoolClause.Right, depth, clause.BoolClause.Operator, clauses)
+	}
+	return nil
+}
+
+func (p *Policy) checkQuery(def *PgDefinition, q cql.Query) error {
+	clauses := 0
+	err := p.checkClause(def, q.Clause, 0, "", &clauses)
+	if err != nil {
+		return err
+	}
+	if p.MaxSortKeys > 0 && len(q.SortSpec) > p.MaxSortKeys {
+		return &PermissionError{Reason: fmt.Sprintf("too many sort keys, at most %d allowed", p.MaxSortKeys)}
+	}
+	for _, sort := range q.SortSpec {
+		if !p.fieldAllowed(def, sort.Index) || containsField(def, p.DeniedSortFields, sort.Index) {
+			return &PermissionError{Clause: "sortby " + sort.String(), Reason: "sort by " + sort.Index}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package pgcql
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Querier is the subset of pgx used by the helpers in this package.
+// It is implemented by *pgx.Conn, *pgxpool.Pool and pgx.Tx.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
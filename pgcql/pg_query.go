@@ -1,6 +1,7 @@
 package pgcql
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -9,24 +10,89 @@ import (
 
 type PgQuery struct {
 	def                *PgDefinition
+	version            string
 	queryArgumentIndex int
 	arguments          []any
+	where              Expr
 	whereClause        string
 	orderByClause      string
 	orderByFields      []string
+	sortClause         string
+	sortFields         []string
+	rankings           []Expr
+	// related is the field of the group being generated, whose inner field is used for search clauses
+	related *FieldRelated
+	// negated is the number of NOTs the clause being generated is the right operand of
+	negated int
 }
 
-func (p *PgQuery) parse(q cql.Query, queryArgumentIndex int, def *PgDefinition) error {
+// rankingField is implemented by fields that order results by relevance for some search clauses.
+// The returned expression may refer to the term, the first Param generated for the clause, or be nil.
+type rankingField interface {
+	rank(sc cql.SearchClause, term *Param) Expr
+}
+
+func (p *PgQuery) parse(ctx context.Context, q cql.Query, queryArgumentIndex int, def *PgDefinition, scope Expr) error {
 	p.def = def
+	p.version = def.version
 	p.arguments = make([]any, 0)
 	p.queryArgumentIndex = queryArgumentIndex
 	p.orderByFields = make([]string, 0)
-	err := p.parseClause(q.Clause, 0)
+	q, err := def.resolveQuery(q)
+	if err != nil {
+		return err
+	}
+	if policy := PolicyFromContext(ctx); policy != nil {
+		if err := policy.checkQuery(def, q); err != nil {
+			return err
+		}
+	}
+	where, err := p.parseClause(q.Clause, 0)
+	if err != nil {
+		return err
+	}
+	if err := def.limits.checkQuery(where); err != nil {
+		return err
+	}
+	if scope != nil {
+		where = &Bool{Op: OpAnd, Left: scope, Right: &Paren{Expr: where}}
+	}
+	p.where = where
+	err = p.parseSortSpec(q.SortSpec)
 	if err != nil {
 		return err
 	}
-	return p.parseSortSpec(q.SortSpec)
+	p.sortClause = p.orderByClause
+	p.sortFields = p.orderByFields
+	res := p.Render(RenderOptions{Index: queryArgumentIndex})
+	p.whereClause = res.WhereClause
+	p.orderByClause = res.OrderByClause
+	p.orderByFields = res.OrderByFields
+	p.arguments = res.Arguments
+	return nil
+}
 
+// Render renders the WHERE and ORDER BY clauses with the placeholder style of opts.
+// The query arguments of the ORDER BY clause follow those of the WHERE clause.
+func (p *PgQuery) Render(opts RenderOptions) *RenderedQuery {
+	r := newRenderer(opts)
+	res := &RenderedQuery{
+		WhereClause:   r.render(p.where),
+		OrderByClause: p.sortClause,
+		OrderByFields: append(make([]string, 0, len(p.sortFields)), p.sortFields...),
+	}
+	for _, expr := range p.rankings {
+		rank := r.render(expr)
+		if res.OrderByClause == "" {
+			res.OrderByClause = " ORDER BY "
+		} else {
+			res.OrderByClause += ", "
+		}
+		res.OrderByClause += rank + " DESC"
+	}
+	res.Arguments = r.args
+	res.NamedArguments = r.named
+	return res
 }
 
 func (p *PgQuery) parseSortSpec(sortSpec []cql.Sort) error {
@@ -38,7 +104,7 @@ func (p *PgQuery) parseSortSpec(sortSpec []cql.Sort) error {
 		if i > 0 {
 			p.orderByClause += ", "
 		}
-		fieldType := p.def.GetFieldType(sortField.Index)
+		fieldType := p.def.fieldType(sortField.Index)
 		if fieldType == nil {
 			return &PgError{message: fmt.Sprintf("unknown field %s", sortField.Index)}
 		}
@@ -63,51 +129,97 @@ func (p *PgQuery) parseSortSpec(sortSpec []cql.Sort) error {
 	return nil
 }
 
-func (p *PgQuery) parseClause(sc cql.Clause, level int) error {
+func (p *PgQuery) parseClause(sc cql.Clause, level int) (Expr, error) {
 	if sc.SearchClause != nil {
 		index := sc.SearchClause.Index
-		fieldType := p.def.GetFieldType(index)
+		fieldType := p.def.fieldType(index)
 		if fieldType == nil {
-			return &PgError{message: fmt.Sprintf("unknown field %s", index)}
+			return nil, &PgError{message: fmt.Sprintf("unknown field %s", index)}
+		}
+		if p.related != nil {
+			if related, ok := fieldType.(*FieldRelated); ok {
+				fieldType = related.field
+			}
+		}
+		fieldType = p.def.fieldNullPolicy(fieldType)
+		if err := p.def.limits.checkSearchClause(sc.SearchClause, fieldType); err != nil {
+			return nil, err
 		}
-		sql, args, err := fieldType.Generate(*sc.SearchClause, p.queryArgumentIndex)
+		expr, err := generateExpr(fieldType, *sc.SearchClause)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		p.whereClause += sql
-		if args != nil {
-			p.queryArgumentIndex += len(args)
-			p.arguments = append(p.arguments, args...)
+		// no ranking by terms that a NOT excludes
+		if rf, ok := fieldType.(rankingField); ok && p.related == nil && p.negated == 0 {
+			if rank := rf.rank(*sc.SearchClause, firstParam(expr)); rank != nil {
+				p.rankings = append(p.rankings, rank)
+			}
 		}
-		return nil
+		return expr, nil
 	} else if sc.BoolClause != nil {
-		if level > 0 {
-			p.whereClause += "("
+		if p.related == nil {
+			if group := p.def.clauseGroup(sc); group != "" {
+				return p.parseGroup(sc, group)
+			}
+			sc, _ = p.def.groupAndOperands(sc)
 		}
-		err := p.parseClause(sc.BoolClause.Left, level+1)
+		left, err := p.parseClause(sc.BoolClause.Left, level+1)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		var op BoolOp
 		switch sc.BoolClause.Operator {
-		case cql.AND:
-			p.whereClause += " AND "
+		case cql.AND, cql.NOT:
+			op = OpAnd
 		case cql.OR:
-			p.whereClause += " OR "
-		case cql.NOT:
-			p.whereClause += " AND NOT "
+			op = OpOr
 		default:
-			return &PgError{message: fmt.Sprintf("unsupported operator %s", sc.BoolClause.Operator)}
+			return nil, &PgError{message: fmt.Sprintf("unsupported operator %s", sc.BoolClause.Operator)}
+		}
+		if sc.BoolClause.Operator == cql.NOT {
+			p.negated++
+		}
+		right, err := p.parseClause(sc.BoolClause.Right, level+1)
+		if sc.BoolClause.Operator == cql.NOT {
+			p.negated--
 		}
-		err = p.parseClause(sc.BoolClause.Right, level+1)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if sc.BoolClause.Operator == cql.NOT {
+			// a NULL (unknown) right operand of NOT is a non-match unless using SQL semantics
+			if p.def.nullPolicy != NullSQL {
+				right = Seq{Text("COALESCE("), right, Text(", FALSE)")}
+			}
+			right = &Not{Expr: right}
 		}
+		var expr Expr = &Bool{Op: op, Left: left, Right: right}
 		if level > 0 {
-			p.whereClause += ")"
+			expr = &Paren{Expr: expr}
 		}
-		return nil
+		return expr, nil
 	}
-	return &PgError{message: "unsupported clause type"}
+	return nil, &PgError{message: "unsupported clause type"}
+}
+
+// parseGroup generates a clause of a field group as a single EXISTS subquery.
+func (p *PgQuery) parseGroup(sc cql.Clause, group string) (Expr, error) {
+	related, err := p.def.groupField(sc, group, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.related = related
+	expr, err := p.parseClause(sc, 1)
+	p.related = nil
+	if err != nil {
+		return nil, err
+	}
+	return related.exists(expr), nil
+}
+
+// GetWhereExpr returns the expression tree of the WHERE clause.
+func (p *PgQuery) GetWhereExpr() Expr {
+	return p.where
 }
 
 func (p *PgQuery) GetWhereClause() string {
@@ -125,3 +237,8 @@ func (p *PgQuery) GetOrderByClause() string {
 func (p *PgQuery) GetOrderByFields() []string {
 	return p.orderByFields
 }
+
+// GetVersion returns the version of the definition that generated the query, see PgDefinition.WithVersion.
+func (p *PgQuery) GetVersion() string {
+	return p.version
+}
@@ -0,0 +1,97 @@
+package pgcql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PlaceholderStyle is the syntax of query argument placeholders in rendered SQL.
+type PlaceholderStyle int
+
+const (
+	// PlaceholderDollar numbers placeholders $1, $2 and so on (PostgreSQL, pgx, lib/pq).
+	PlaceholderDollar PlaceholderStyle = iota
+	// PlaceholderQuestion uses ? for every placeholder, for drivers and query builders that bind ? placeholders
+	// to PostgreSQL. An argument used more than once is repeated in the arguments.
+	// The SQL is not escaped: a literal ? in field SQL, templates or scopes, such as the jsonb ? operator,
+	// is taken as a placeholder, so use functions such as jsonb_exists instead.
+	PlaceholderQuestion
+	// PlaceholderNamed names placeholders @p1, @p2 and so on, compatible with pgx.NamedArgs.
+	PlaceholderNamed
+)
+
+// RenderOptions controls rendering of an expression tree.
+type RenderOptions struct {
+	Style PlaceholderStyle
+	// Index is the number of the first placeholder for PlaceholderDollar and PlaceholderNamed, default 1.
+	Index int
+	// NamePrefix is the prefix of PlaceholderNamed placeholders, default "p".
+	// Use different prefixes when several queries are combined into one statement.
+	NamePrefix string
+}
+
+// RenderedQuery is a query rendered with RenderOptions.
+type RenderedQuery struct {
+	WhereClause   string
+	OrderByClause string
+	OrderByFields []string
+	// Arguments in placeholder order. For PlaceholderQuestion this is the order of the placeholders
+	// in the WHERE clause followed by the ORDER BY clause.
+	Arguments []any
+	// NamedArguments by placeholder name without @ for PlaceholderNamed, otherwise nil.
+	// It can be passed to pgx as pgx.NamedArgs(NamedArguments).
+	NamedArguments map[string]any
+}
+
+type renderer struct {
+	sb     strings.Builder
+	opts   RenderOptions
+	params map[*Param]int
+	args   []any
+	named  map[string]any
+}
+
+func newRenderer(opts RenderOptions) *renderer {
+	if opts.Index == 0 {
+		opts.Index = 1
+	}
+	if opts.NamePrefix == "" {
+		opts.NamePrefix = "p"
+	}
+	r := &renderer{opts: opts, params: make(map[*Param]int), args: make([]any, 0)}
+	if opts.Style == PlaceholderNamed {
+		r.named = make(map[string]any)
+	}
+	return r
+}
+
+func (r *renderer) render(expr Expr) string {
+	r.sb.Reset()
+	expr.render(r)
+	return r.sb.String()
+}
+
+func (r *renderer) placeholder(p *Param) {
+	n, ok := r.params[p]
+	if !ok {
+		n = r.opts.Index + len(r.params)
+		r.params[p] = n
+	}
+	switch r.opts.Style {
+	case PlaceholderQuestion:
+		r.sb.WriteString("?")
+		r.args = append(r.args, p.Value)
+	case PlaceholderNamed:
+		name := r.opts.NamePrefix + strconv.Itoa(n)
+		r.sb.WriteString("@" + name)
+		if !ok {
+			r.args = append(r.args, p.Value)
+			r.named[name] = p.Value
+		}
+	default:
+		r.sb.WriteString("$" + strconv.Itoa(n))
+		if !ok {
+			r.args = append(r.args, p.Value)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package pgcql
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/indexdata/cql-go/cql"
+	"github.com/jackc/pgx/v5"
+)
+
+// ScanQuery holds the statements for an SRU scan around a start term.
+// Before selects terms preceding the start term in descending order and
+// After selects the start term (unless responsePosition is 0) and the terms
+// following it in ascending order. Either may be nil if no terms are wanted.
+type ScanQuery struct {
+	Index   string
+	Term    string
+	Before  *FacetQuery
+	After   *FacetQuery
+	Version string // version of the definition
+}
+
+// ScanTerm is an index term with the number of records it occurs in.
+type ScanTerm struct {
+	Value           string
+	NumberOfRecords int64
+}
+
+// scanTermField is implemented by fields that compare scan terms as typed values.
+type scanTermField interface {
+	scanTerm(term string) (any, error)
+}
+
+func (f *FieldCommon) scanTerm(term string) (any, error) {
+	return term, nil
+}
+
+func (f *FieldNumber) scanTerm(term string) (any, error) {
+	return f.parseTerm(term)
+}
+
+func (f *FieldDateTime) scanTerm(term string) (any, error) {
+	t, err := f.parseTerm(term)
+	if err != nil {
+		return nil, f.invalidTerm(term)
+	}
+	return t, nil
+}
+
+func (pg *PgDefinition) parseScanClause(scanClause string) (*cql.SearchClause, error) {
+	var parser cql.Parser
+	q, err := parser.Parse(scanClause)
+	if err != nil {
+		return nil, err
+	}
+	if q.SearchClause == nil || len(q.SortSpec) > 0 {
+		return nil, &PgError{message: "scan clause must be a single search clause"}
+	}
+	clause, err := pg.resolveClause(q.Clause, nil)
+	if err != nil {
+		return nil, err
+	}
+	sc := clause.SearchClause
+	switch sc.Relation {
+	case cql.EQ, cql.SCR, "==", cql.EXACT:
+	default:
+		return nil, &PgError{message: "unsupported scan relation " + string(sc.Relation)}
+	}
+	return sc, nil
+}
+
+// GenerateScan validates an SRU scanClause, e.g. `title = "comp"`, and returns the statements
+// for the terms of the index before and after the start term.
+// responsePosition is the 1-based position of the start term in the response, where 0 means the
+// start term is immediately before the first returned term, and maximumTerms is the number of terms.
+// Terms are only counted in rows within the scope of ctx.
+func (pg *PgDefinition) GenerateScan(ctx context.Context, scanClause string, from string, responsePosition int, maximumTerms int) (*ScanQuery, error) {
+	scope, err := pg.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+	sc, err := pg.parseScanClause(scanClause)
+	if err != nil {
+		return nil, err
+	}
+	if policy := PolicyFromContext(ctx); policy != nil {
+		if err := policy.checkSearchClause(pg, sc); err != nil {
+			return nil, err
+		}
+	}
+	if maximumTerms < 1 {
+		return nil, &PgError{message: "maximumTerms must be positive"}
+	}
+	if responsePosition < 0 {
+		return nil, &PgError{message: "responsePosition must not be negative"}
+	}
+	field := pg.fieldType(sc.Index)
+	if field == nil {
+		return nil, &PgError{message: fmt.Sprintf("unknown field %s", sc.Index)}
+	}
+	column := field.GetColumn()
+	if column == "" {
+		return nil, &PgError{message: fmt.Sprintf("field %s does not support scan", sc.Index)}
+	}
+	var term any = sc.Term
+	if tf, ok := field.(scanTermField); ok && sc.Term != "" {
+		term, err = tf.scanTerm(sc.Term)
+		if err != nil {
+			return nil, err
+		}
+	}
+	before := min(max(responsePosition-1, 0), maximumTerms)
+	after := maximumTerms - before
+	query := &ScanQuery{Index: sc.Index, Term: sc.Term, Version: pg.version}
+	if before > 0 && sc.Term != "" {
+		query.Before = generateScanQuery(column, from, "<", "DESC", term, before, scope)
+		query.Before.Version = pg.version
+	}
+	if after > 0 {
+		op := ">="
+		if responsePosition == 0 {
+			op = ">"
+		}
+		if sc.Term == "" {
+			op = ""
+		}
+		query.After = generateScanQuery(column, from, op, "", term, after, scope)
+		query.After.Version = pg.version
+	}
+	return query, nil
+}
+
+func generateScanQuery(column string, from string, op string, dir string, term any, limit int, scope Expr) *FacetQuery {
+	where := Seq{Text("(" + column + ") IS NOT NULL")}
+	if op != "" {
+		where = append(where, Text(" AND ("+column+") "+op+" "), &Param{Value: term})
+	}
+	if scope != nil {
+		where = append(where, Text(" AND "), scope)
+	}
+	cond, args := RenderExpr(where, 1)
+	sql := "SELECT (" + column + ")::text AS term, count(*) AS count FROM " + from + " WHERE " + cond
+	sql += " GROUP BY (" + column + ") ORDER BY (" + column + ")"
+	if dir != "" {
+		sql += " " + dir
+	}
+	args = append(args, limit)
+	sql += fmt.Sprintf(" LIMIT $%d", len(args))
+	return &FacetQuery{SQL: sql, Arguments: args}
+}
+
+func runScanQuery(ctx context.Context, conn Querier, fq *FacetQuery) ([]ScanTerm, error) {
+	if fq == nil {
+		return []ScanTerm{}, nil
+	}
+	rows, err := conn.Query(ctx, fq.SQL, fq.Arguments...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (ScanTerm, error) {
+		var st ScanTerm
+		err := row.Scan(&st.Value, &st.NumberOfRecords)
+		return st, err
+	})
+}
+
+// Scan executes an SRU scan and returns the terms in index order.
+func Scan(ctx context.Context, conn Querier, def *PgDefinition, scanClause string, from string, responsePosition int, maximumTerms int) ([]ScanTerm, error) {
+	query, err := def.GenerateScan(ctx, scanClause, from, responsePosition, maximumTerms)
+	if err != nil {
+		return nil, err
+	}
+	before, err := runScanQuery(ctx, conn, query.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := runScanQuery(ctx, conn, query.After)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(before)
+	return append(before, after...), nil
+}
+
+// ScanResponse writes an SRU scanResponse document.
+type ScanResponse struct {
+	w   io.Writer
+	err error
+	tab int
+}
+
+func (sr *ScanResponse) write(msg string) {
+	_, err := sr.w.Write([]byte(msg))
+	if err != nil && sr.err == nil {
+		sr.err = err
+	}
+}
+
+func (sr *ScanResponse) cdata(msg string) {
+	err := xml.EscapeText(sr.w, []byte(msg))
+	if err != nil && sr.err == nil {
+		sr.err = err
+	}
+}
+
+func (sr *ScanResponse) pr(level int, msg string) {
+	for i := 0; i < level*sr.tab; i++ {
+		sr.write(" ")
+	}
+	sr.write(msg)
+}
+
+func (sr *ScanResponse) Write(terms []ScanTerm, tab int, w io.Writer) error {
+	sr.w = w
+	sr.tab = tab
+	sr.pr(0, "<scanResponse xmlns=\"http://docs.oasis-open.org/ns/search-ws/scan\">\n")
+	if len(terms) > 0 {
+		sr.pr(1, "<terms>\n")
+		for _, term := range terms {
+			sr.pr(2, "<term>\n")
+			sr.pr(3, "<value>")
+			sr.cdata(term.Value)
+			sr.pr(0, "</value>\n")
+			sr.pr(3, "<numberOfRecords>")
+			sr.write(strconv.FormatInt(term.NumberOfRecords, 10))
+			sr.pr(0, "</numberOfRecords>\n")
+			sr.pr(2, "</term>\n")
+		}
+		sr.pr(1, "</terms>\n")
+	}
+	sr.pr(0, "</scanResponse>\n")
+	return sr.err
+}
+
+func (sr *ScanResponse) MarshalIndent(terms []ScanTerm, tab int) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := sr.Write(terms, tab, buf)
+	return buf.Bytes(), err
+}
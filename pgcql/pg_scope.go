@@ -0,0 +1,87 @@
+package pgcql
+
+import (
+	"context"
+	"slices"
+
+	"github.com/indexdata/cql-go/cql"
+)
+
+// ScopeFunc returns a scoping predicate for the request context. It may return nil for no restriction
+// or an error to reject the query, e.g. when the context has no tenant.
+type ScopeFunc func(ctx context.Context) (Expr, error)
+
+// SQLExpr returns an expression for SQL with placeholders $1, $2 and so on referring to args.
+// Placeholders in string literals, quoted identifiers and dollar-quoted strings are not replaced.
+// Placeholders without argument are kept as text and arguments without placeholder are dropped.
+func SQLExpr(sql string, args ...any) Expr {
+	expr, _ := parseSQLExpr(sql, args, 1)
+	return expr
+}
+
+// AddScope adds a predicate that is ANDed with every query, e.g. AddScope("tenant_id = $1", tenant).
+// Placeholders are numbered from $1 and renumbered in the generated WHERE clause. A placeholder without
+// argument, or an argument without placeholder, makes queries fail.
+func (pg *PgDefinition) AddScope(sql string, args ...any) *PgDefinition {
+	expr, err := parseSQLExpr(sql, args, 1)
+	return pg.AddScopeFunc(func(ctx context.Context) (Expr, error) {
+		return expr, err
+	})
+}
+
+// AddScopeFunc adds a predicate computed from the request context that is ANDed with every query.
+// The function is called without holding the lock of the definition, so it may use the definition.
+func (pg *PgDefinition) AddScopeFunc(fn ScopeFunc) *PgDefinition {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.scopes = append(pg.scopes, fn)
+	return pg
+}
+
+// scope returns the conjunction of the scoping predicates for ctx or nil if there are none.
+// Each predicate is parenthesized so that it cannot combine with the query in other ways.
+// It must be called without holding pg.mu: the functions are called after the lock is released,
+// so that they may use the definition, e.g. add a field, without deadlocking.
+func (pg *PgDefinition) scope(ctx context.Context) (Expr, error) {
+	pg.mu.RLock()
+	scopes := slices.Clone(pg.scopes)
+	pg.mu.RUnlock()
+	var scope Expr
+	for _, fn := range scopes {
+		expr, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if expr == nil {
+			continue
+		}
+		expr = &Paren{Expr: expr}
+		if scope == nil {
+			scope = expr
+		} else {
+			scope = &Bool{Op: OpAnd, Left: scope, Right: expr}
+		}
+	}
+	return scope, nil
+}
+
+// ParseContext converts the query like Parse, checks it against the Policy of ctx, if any,
+// and ANDs the result with the scoping predicates for ctx.
+// The WHERE clause of the query is then parenthesized, e.g. `(tenant_id = $1) AND (title = $2 OR year > $3)`,
+// so that no CQL query can match rows outside the scope.
+func (pg *PgDefinition) ParseContext(ctx context.Context, q cql.Query, queryArgumentIndex int) (*PgQuery, error) {
+	scope, err := pg.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+	return pg.parseContext(ctx, q, queryArgumentIndex, scope)
+}
+
+// parseContext converts the query and ANDs the result with scope, which may be nil.
+func (pg *PgDefinition) parseContext(ctx context.Context, q cql.Query, queryArgumentIndex int, scope Expr) (*PgQuery, error) {
+	query := &PgQuery{}
+	err := query.parse(ctx, q, queryArgumentIndex, pg, scope)
+	return query, err
+}
@@ -0,0 +1,151 @@
+package pgcql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CountMode is how Search determines the total number of matching rows.
+type CountMode int
+
+const (
+	CountExact    CountMode = iota // a separate SELECT count(*) statement
+	CountWindow                    // count(*) OVER() in the page statement
+	CountEstimate                  // the number of rows estimated by EXPLAIN
+	CountNone                      // no count, Total is -1
+)
+
+// SearchRequest is a page of rows to select for a query.
+type SearchRequest struct {
+	From    string   // table name, possibly with joins
+	Columns []string // selected columns, all columns if empty
+	Offset  int      // number of rows to skip
+	Limit   int      // maximum number of rows, no limit if 0
+	Count   CountMode
+}
+
+// SearchResult is a page of rows with the total number of matching rows.
+type SearchResult[T any] struct {
+	Items          []T
+	Total          int64
+	TotalEstimated bool // Total is estimated by EXPLAIN
+}
+
+// windowRows hide the count(*) OVER() column, which is the last column, from the row function.
+// Values are returned as is if there is no row.
+type windowRows struct {
+	pgx.Rows
+	total *int64
+}
+
+func (r windowRows) FieldDescriptions() []pgconn.FieldDescription {
+	fields := r.Rows.FieldDescriptions()
+	if len(fields) == 0 {
+		return fields
+	}
+	return fields[:len(fields)-1]
+}
+
+func (r windowRows) Scan(dest ...any) error {
+	if len(dest) == 1 {
+		if scanner, ok := dest[0].(pgx.RowScanner); ok {
+			values, err := r.Rows.Values()
+			if err != nil {
+				return err
+			}
+			if len(values) > 0 {
+				*r.total, _ = values[len(values)-1].(int64)
+			}
+			return scanner.ScanRow(r)
+		}
+	}
+	return r.Rows.Scan(append(dest, r.total)...)
+}
+
+func (r windowRows) Values() ([]any, error) {
+	values, err := r.Rows.Values()
+	if err != nil || len(values) == 0 {
+		return values, err
+	}
+	return values[:len(values)-1], nil
+}
+
+func (r windowRows) RawValues() [][]byte {
+	values := r.Rows.RawValues()
+	if len(values) == 0 {
+		return values
+	}
+	return values[:len(values)-1]
+}
+
+// Search selects a page of rows matching the query and counts the matching rows. The query must be parsed
+// with queryArgumentIndex 1. Rows are converted by rowTo, e.g. pgx.RowToStructByName[Instance] or pgx.RowToMap.
+func Search[T any](ctx context.Context, conn Querier, query Query, req SearchRequest, rowTo pgx.RowToFunc[T]) (*SearchResult[T], error) {
+	columns := "*"
+	if len(req.Columns) > 0 {
+		columns = strings.Join(req.Columns, ", ")
+	}
+	if req.Count == CountWindow {
+		columns += ", count(*) OVER() AS total_count"
+	}
+	where := " FROM " + req.From + " WHERE " + query.GetWhereClause()
+	args := query.GetQueryArguments()
+	sql := "SELECT " + columns + where + query.GetOrderByClause()
+	pageArgs := append([]any{}, args...)
+	if req.Limit > 0 {
+		pageArgs = append(pageArgs, req.Limit)
+		sql += fmt.Sprintf(" LIMIT $%d", len(pageArgs))
+	}
+	if req.Offset > 0 {
+		pageArgs = append(pageArgs, req.Offset)
+		sql += fmt.Sprintf(" OFFSET $%d", len(pageArgs))
+	}
+	rows, err := conn.Query(ctx, sql, pageArgs...)
+	if err != nil {
+		return nil, err
+	}
+	result := &SearchResult[T]{Total: -1}
+	var total int64
+	if req.Count == CountWindow {
+		rows = windowRows{Rows: rows, total: &total}
+	}
+	result.Items, err = pgx.CollectRows(rows, rowTo)
+	if err != nil {
+		return nil, err
+	}
+	switch req.Count {
+	case CountWindow:
+		result.Total = total
+		if len(result.Items) > 0 || req.Offset == 0 {
+			break
+		}
+		// the page is past the last row, so there is no row with the count
+		fallthrough
+	case CountExact:
+		rows, err := conn.Query(ctx, "SELECT count(*)"+where, args...)
+		if err != nil {
+			return nil, err
+		}
+		result.Total, err = pgx.CollectExactlyOneRow(rows, pgx.RowTo[int64])
+		if err != nil {
+			return nil, err
+		}
+	case CountEstimate:
+		report, err := (&CostGuard{}).ExplainSQL(ctx, conn, "SELECT 1"+where, args...)
+		if err != nil {
+			return nil, err
+		}
+		result.Total = int64(report.Rows)
+		result.TotalEstimated = true
+	}
+	return result, nil
+}
+
+// SearchMaps is Search with rows converted to maps from column name to value.
+func SearchMaps(ctx context.Context, conn Querier, query Query, req SearchRequest) (*SearchResult[map[string]any], error) {
+	return Search(ctx, conn, query, req, pgx.RowToMap)
+}
@@ -0,0 +1,191 @@
+package pgcql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/indexdata/cql-go/cql"
+)
+
+// ErrorKind classifies errors of parsing and executing queries, see ClassifyError.
+type ErrorKind int
+
+const (
+	ErrorInternal     ErrorKind = iota // misconfiguration or unexpected database error
+	ErrorInvalidQuery                  // the query is invalid, e.g. a CQL syntax error or unknown field
+	ErrorPermission                    // the query is denied by a Policy
+	ErrorTooExpensive                  // the query is rejected by a CostGuard
+	ErrorTimeout                       // the query was canceled or timed out
+	ErrorUnavailable                   // the database is unavailable
+)
+
+// QueryError is an error of parsing or executing a query with the kind of error.
+// SQLState is the SQLSTATE code for errors reported by the database.
+type QueryError struct {
+	Kind     ErrorKind
+	SQLState string
+	Err      error
+}
+
+func (e *QueryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus returns the HTTP status code for the kind of error, e.g. 400 for ErrorInvalidQuery.
+func (e *QueryError) HTTPStatus() int {
+	switch e.Kind {
+	case ErrorInvalidQuery:
+		return http.StatusBadRequest
+	case ErrorPermission:
+		return http.StatusForbidden
+	case ErrorTooExpensive:
+		return http.StatusUnprocessableEntity
+	case ErrorTimeout:
+		return http.StatusGatewayTimeout
+	case ErrorUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// Diagnostic is an SRU diagnostic, see https://www.loc.gov/standards/sru/diagnostics/diagnosticsList.html.
+type Diagnostic struct {
+	URI     string // e.g. info:srw/diagnostic/1/10
+	Message string // a short description of the kind of error, e.g. "Query syntax error"
+	Details string // the error message
+}
+
+// Diagnostic returns the SRU diagnostic for the kind of error, e.g. info:srw/diagnostic/1/10 for ErrorInvalidQuery
+// and info:srw/diagnostic/1/48 with message "Query too complex" for a query rejected by a CostGuard.
+func (e *QueryError) Diagnostic() Diagnostic {
+	d := Diagnostic{URI: "info:srw/diagnostic/1/1", Message: "General system error", Details: e.Error()}
+	switch e.Kind {
+	case ErrorInvalidQuery:
+		d.URI, d.Message = "info:srw/diagnostic/1/10", "Query syntax error"
+	case ErrorPermission:
+		d.URI, d.Message = "info:srw/diagnostic/1/3", "Authentication error"
+	case ErrorTooExpensive:
+		d.URI, d.Message = "info:srw/diagnostic/1/48", "Query too complex"
+	case ErrorTimeout, ErrorUnavailable:
+		d.URI, d.Message = "info:srw/diagnostic/1/2", "System temporarily unavailable"
+	}
+	return d
+}
+
+// sqlStateError is implemented by the errors of lib/pq and pgx.
+type sqlStateError interface {
+	SQLState() string
+}
+
+// ClassifyError returns the error as a *QueryError. It handles the errors of this package, of the cql parser,
+// of the context and of database drivers reporting SQLSTATE codes, e.g. lib/pq and pgx. A nil error returns nil.
+func ClassifyError(err error) *QueryError {
+	if err == nil {
+		return nil
+	}
+	var queryError *QueryError
+	if errors.As(err, &queryError) {
+		return queryError
+	}
+	var parseError *cql.ParseError
+	var pgError *PgError
+	var permissionError *PermissionError
+	var costError *CostError
+	var stateError sqlStateError
+	switch {
+	case errors.As(err, &permissionError):
+		return &QueryError{Kind: ErrorPermission, Err: err}
+	case errors.As(err, &costError):
+		return &QueryError{Kind: ErrorTooExpensive, Err: err}
+	case errors.As(err, &parseError), errors.As(err, &pgError):
+		return &QueryError{Kind: ErrorInvalidQuery, Err: err}
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return &QueryError{Kind: ErrorTimeout, Err: err}
+	case errors.As(err, &stateError):
+		state := stateError.SQLState()
+		kind := ErrorInternal
+		switch {
+		case state == "57014": // query_canceled, e.g. by statement_timeout
+			kind = ErrorTimeout
+		case strings.HasPrefix(state, "22"): // data exception, e.g. a term invalid for the column type
+			kind = ErrorInvalidQuery
+		case strings.HasPrefix(state, "08"), strings.HasPrefix(state, "53"), strings.HasPrefix(state, "57"):
+			kind = ErrorUnavailable
+		}
+		return &QueryError{Kind: kind, SQLState: state, Err: err}
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return &QueryError{Kind: ErrorUnavailable, Err: err}
+	}
+	return &QueryError{Kind: ErrorInternal, Err: err}
+}
+
+// pgArray is a list argument passed as a PostgreSQL array literal, which every driver passes as text.
+type pgArray string
+
+func (a pgArray) Value() (driver.Value, error) {
+	return string(a), nil
+}
+
+func arrayLiteral[T any](list []T, format func(T) string) pgArray {
+	elements := make([]string, len(list))
+	for i, v := range list {
+		elements[i] = format(v)
+	}
+	return pgArray("{" + strings.Join(elements, ",") + "}")
+}
+
+func quoteArrayElement(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// SQLArguments converts query arguments for database/sql drivers. Lists, e.g. []string of the any relation,
+// are passed as array literals, as drivers such as lib/pq do not accept slices. Times are passed in UTC.
+func SQLArguments(args []any) []any {
+	sqlArgs := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case []string:
+			sqlArgs[i] = arrayLiteral(v, quoteArrayElement)
+		case []int64:
+			sqlArgs[i] = arrayLiteral(v, func(n int64) string { return strconv.FormatInt(n, 10) })
+		case []float64:
+			sqlArgs[i] = arrayLiteral(v, func(n float64) string { return strconv.FormatFloat(n, 'g', -1, 64) })
+		case []bool:
+			sqlArgs[i] = arrayLiteral(v, strconv.FormatBool)
+		case []time.Time:
+			sqlArgs[i] = arrayLiteral(v, func(t time.Time) string { return quoteArrayElement(t.UTC().Format(time.RFC3339Nano)) })
+		case time.Time:
+			sqlArgs[i] = v.UTC()
+		default:
+			sqlArgs[i] = arg
+		}
+	}
+	return sqlArgs
+}
+
+// SQLQuerier is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type SQLQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// QuerySQL executes the statement consisting of selectClause, e.g. "SELECT id FROM mytable", followed by
+// the WHERE and ORDER BY clauses of the query, which must be parsed with queryArgumentIndex 1.
+// Errors are returned as *QueryError; errors of the returned rows can be classified with ClassifyError.
+func QuerySQL(ctx context.Context, db SQLQuerier, selectClause string, query Query) (*sql.Rows, error) {
+	stmt := selectClause + " WHERE " + query.GetWhereClause() + query.GetOrderByClause()
+	rows, err := db.QueryContext(ctx, stmt, SQLArguments(query.GetQueryArguments())...)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,245 @@
+package pgcql
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SchemaProblem is a field or facet whose column does not match the database schema.
+type SchemaProblem struct {
+	Field   string // name of the field, or "facet " and the name of the facet
+	Column  string
+	Message string
+}
+
+func (p SchemaProblem) String() string {
+	return p.Field + ": " + p.Message
+}
+
+// SchemaError is returned by Validate with all the problems found.
+type SchemaError struct {
+	Problems []SchemaProblem
+}
+
+func (e *SchemaError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.String()
+	}
+	return "definition does not match schema: " + strings.Join(msgs, "; ")
+}
+
+// schemaColumn is a column expression of a field with the kind of type expected,
+// e.g. "string", or an empty kind if any type will do.
+type schemaColumn struct {
+	column   string
+	from     string
+	kind     string
+	typeName string // if not empty, the exact type expected
+}
+
+// schemaField is implemented by fields that know the type of their column.
+type schemaField interface {
+	schemaColumns() []schemaColumn
+}
+
+func (f *FieldString) schemaColumns() []schemaColumn {
+	if f.assumeTsVector {
+		return []schemaColumn{{column: f.column, kind: "tsvector"}}
+	}
+	return []schemaColumn{{column: f.column, kind: "string"}}
+}
+
+func (f *FieldNumber) schemaColumns() []schemaColumn {
+	return []schemaColumn{{column: f.column, kind: "number"}}
+}
+
+func (f *FieldDateTime) schemaColumns() []schemaColumn {
+	return []schemaColumn{{column: f.column, kind: "datetime"}}
+}
+
+func (f *FieldBool) schemaColumns() []schemaColumn {
+	return []schemaColumn{{column: f.column, kind: "boolean"}}
+}
+
+func (f *FieldRange) schemaColumns() []schemaColumn {
+	return []schemaColumn{{column: f.column, kind: "range", typeName: string(f.rangeType)}}
+}
+
+func (f *FieldCombo) schemaColumns() []schemaColumn {
+	var columns []schemaColumn
+	for _, field := range f.fields {
+		columns = append(columns, fieldSchemaColumns(field)...)
+	}
+	return columns
+}
+
+// schemaColumns returns the foreign key and the columns of the inner field in the child table.
+func (f *FieldRelated) schemaColumns() []schemaColumn {
+	from := f.table
+	foreignKey := f.foreignKey
+	if f.alias != "" {
+		from += " " + f.alias
+		foreignKey = f.alias + "." + foreignKey
+	}
+	columns := []schemaColumn{{column: foreignKey, from: from}}
+	for _, column := range fieldSchemaColumns(f.field) {
+		column.from = from
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+func fieldSchemaColumns(field Field) []schemaColumn {
+	if sf, ok := field.(schemaField); ok {
+		return sf.schemaColumns()
+	}
+	if column := field.GetColumn(); column != "" {
+		return []schemaColumn{{column: column}}
+	}
+	return nil
+}
+
+// typeMatches returns true if a type of the pg_type category matches the expected kind.
+func (c schemaColumn) typeMatches(typeName string, category string) bool {
+	if c.typeName != "" && c.typeName != typeName {
+		return false
+	}
+	switch c.kind {
+	case "string":
+		return category == "S"
+	case "number":
+		return category == "N"
+	case "datetime":
+		return category == "D"
+	case "boolean":
+		return category == "B"
+	case "range":
+		return category == "R"
+	case "array":
+		return category == "A"
+	case "tsvector", "jsonb":
+		return typeName == c.kind
+	}
+	return true
+}
+
+// Validate checks that the columns of the fields and facets exist in table and have types compatible with
+// the fields, e.g. a number type for FieldNumber. Columns qualified with a table name, e.g. "publisher.name",
+// are looked up in that table and the columns of related fields in the child table.
+// All problems are returned in a *SchemaError; other errors are returned as is.
+// Each column is checked by a statement of its own, so conn should not be in a transaction.
+func (pg *PgDefinition) Validate(ctx context.Context, conn Querier, table string) error {
+	type check struct {
+		name    string
+		column  schemaColumn
+		oid     uint32
+		message string
+	}
+	var checks []check
+	pg.mu.RLock()
+	names := make([]string, 0, len(pg.fields))
+	for name := range pg.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, column := range fieldSchemaColumns(pg.fields[name]) {
+			checks = append(checks, check{name: name, column: column})
+		}
+	}
+	names = names[:0]
+	for name := range pg.facets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		facet := pg.facets[name]
+		column := schemaColumn{column: facet.GetColumn()}
+		switch facet.GetKind() {
+		case FacetArray:
+			column.kind = "array"
+		case FacetJsonbArray:
+			column.kind = "jsonb"
+		}
+		checks = append(checks, check{name: "facet " + name, column: column})
+	}
+	pg.mu.RUnlock()
+	var oids []uint32
+	for i := range checks {
+		c := &checks[i]
+		if c.column.from == "" {
+			c.column.from = table
+			if m := qualifiedColumn.FindStringSubmatch(c.column.column); m != nil {
+				c.column.from = m[1]
+			}
+		}
+		oid, err := columnType(ctx, conn, c.column)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "42") {
+			c.message = pgErr.Message
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		c.oid = oid
+		oids = append(oids, oid)
+	}
+	rows, err := conn.Query(ctx, "SELECT oid, typname::text, typcategory::text FROM pg_type WHERE oid = ANY($1)", oids)
+	if err != nil {
+		return err
+	}
+	type pgType struct {
+		Oid      uint32
+		Name     string
+		Category string
+	}
+	types, err := pgx.CollectRows(rows, pgx.RowToStructByPos[pgType])
+	if err != nil {
+		return err
+	}
+	typeByOid := make(map[uint32]pgType, len(types))
+	for _, t := range types {
+		typeByOid[t.Oid] = t
+	}
+	var problems []SchemaProblem
+	for _, c := range checks {
+		if c.oid != 0 {
+			t := typeByOid[c.oid]
+			if !c.column.typeMatches(t.Name, t.Category) {
+				expected := c.column.kind
+				if c.column.typeName != "" {
+					expected = c.column.typeName
+				}
+				c.message = "column " + c.column.column + " has type " + t.Name + ", expected " + expected
+			}
+		}
+		if c.message != "" {
+			problems = append(problems, SchemaProblem{Field: c.name, Column: c.column.column, Message: c.message})
+		}
+	}
+	if len(problems) > 0 {
+		return &SchemaError{Problems: problems}
+	}
+	return nil
+}
+
+// columnType returns the type of a column expression without reading any rows.
+func columnType(ctx context.Context, conn Querier, column schemaColumn) (uint32, error) {
+	rows, err := conn.Query(ctx, "SELECT ("+column.column+") FROM "+column.from+" LIMIT 0")
+	if err != nil {
+		return 0, err
+	}
+	var oid uint32
+	if fields := rows.FieldDescriptions(); len(fields) == 1 {
+		oid = fields[0].DataTypeOID
+	}
+	rows.Close()
+	return oid, rows.Err()
+}
@@ -6,12 +6,18 @@ import (
 
 type PgError struct {
 	message string
+	err     error
 }
 
 func (e *PgError) Error() string {
 	return e.message
 }
 
+// Unwrap returns the limit exceeded, e.g. ErrMaxArguments, or nil
+func (e *PgError) Unwrap() error {
+	return e.err
+}
+
 type Field interface {
 	GetColumn() string
 	SetColumn(column string)
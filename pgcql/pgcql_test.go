@@ -1,12 +1,18 @@
 package pgcql
 
 import (
+	"context"
+	"database/sql/driver"
+	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/indexdata/cql-go/cql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -61,7 +67,7 @@ func TestMaskedSplitTsTermsTrailingBackslashAfterWildcard(t *testing.T) {
 }
 
 func TestParsing(t *testing.T) {
-	def := NewPgDefinition()
+	def := NewDefinition()
 	title := &FieldString{}
 	title.WithExact().SetColumn("Title")
 
@@ -106,6 +112,12 @@ func TestParsing(t *testing.T) {
 
 	price := NewFieldNumber()
 	def.AddField("price", price)
+	def.AddField("id", NewFieldNumber().WithInteger())
+	def.AddField("amount", NewFieldNumber().WithDecimal().WithMinMax(0, 1000.5))
+	def.AddField("percent", NewFieldNumber().WithMinMax(0, 100))
+	def.AddField("rate", NewFieldNumber().WithDecimal().WithMinMax(0.1, 100))
+	def.AddField("ratio", NewFieldNumber().WithMinMax(0.1, 0.3))
+	def.AddField("big", NewFieldNumber().WithInteger().WithIntegerMinMax(-9007199254740993, 9007199254740993))
 
 	dateField := NewFieldDate().WithOnlyDate()
 	def.AddField("date", dateField)
@@ -116,6 +128,36 @@ func TestParsing(t *testing.T) {
 	boolField := NewFieldBool()
 	def.AddField("bool", boolField)
 
+	def.AddField("fuzzy", NewFieldString().WithExact().WithFuzzy(0).WithColumn("Title"))
+	def.AddField("fuzzyRank", NewFieldString().WithFuzzy(0.4).WithFuzzyRank().WithPhonetic(PhoneticDMetaphone).WithColumn("Title"))
+	def.AddField("soundex", NewFieldString().WithPhonetic(PhoneticSoundex).WithColumn("Author"))
+
+	def.AddField("years", NewFieldRange(RangeInt4))
+	def.AddField("amounts", NewFieldRange(RangeNum))
+	def.AddField("period", NewFieldRange(RangeDate))
+	def.AddField("during", NewFieldRange(RangeTsTz))
+
+	def.AddField("contributor", NewFieldRelated("contributors", "instance_id", "instance.id", NewFieldString().WithLikeOps().WithColumn("name")))
+	def.AddField("contributorType", NewFieldRelated("contributors", "instance_id", "instance.id", NewFieldString().WithExact().WithColumn("type")))
+	def.AddField("barcode", NewFieldRelated("holdings", "instance_id", "instance.id", NewFieldString().WithExact()))
+	def.AddField("holdingsCity", NewFieldRelated("holdings", "instance_id", "instance.id",
+		NewFieldString().WithExact().WithColumn("h.doc->>'city'")).WithAlias("h"))
+
+	def.AddField("contributor.name", NewFieldRelated("contributors", "instance_id", "instance.id", NewFieldString().WithExact().WithColumn("name")))
+	def.AddField("contributor.role", NewFieldRelated("contributors", "instance_id", "instance.id", NewFieldString().WithExact().WithColumn("role")))
+	def.AddField("contributor.title", NewFieldString().WithExact())
+	def.AddFieldGroup("contributor", "contributor.name", "contributor.role", "contributor.title")
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	fixedNow := func() time.Time { return time.Date(2026, 3, 5, 22, 30, 0, 0, time.UTC) }
+	relative := NewFieldDate().WithColumn("datetime").WithLocation(berlin)
+	relative.now = fixedNow
+	def.AddField("local", relative)
+	relativeDate := NewFieldDate().WithOnlyDate().WithColumn("date")
+	relativeDate.now = fixedNow
+	def.AddField("localDate", relativeDate)
+
 	dateTimeWithZone, err := time.Parse(time.RFC3339, "2026-03-05T09:34:27+01:00")
 	assert.NoError(t, err)
 
@@ -226,8 +268,40 @@ func TestParsing(t *testing.T) {
 		{"price < 10.95", "price < $1", []any{10.95}},
 		{"price <= 10.95", "price <= $1", []any{10.95}},
 		{"price <= beta", "error: invalid number beta", nil},
-		{"price all 10.95", "error: unsupported relation all", nil},
+		{"price all 10.95", "price = ALL($1::float8[])", []any{[]float64{10.95}}},
 		{"price = \"\"", "price IS NOT NULL", []any{}},
+		{"price = NaN", "error: invalid number NaN", nil},
+		{"price = 1e400", "error: number 1e400 out of range", nil},
+		{"price any \"1 2.5 3\"", "price = ANY($1::float8[])", []any{[]float64{1, 2.5, 3}}},
+		{"price <> \"1 2\"", "price <> ALL($1::float8[])", []any{[]float64{1, 2}}},
+		{"price <> 1", "price <> $1", []any{1.0}},
+		{"price adj \"1 2\"", "error: unsupported relation adj", nil},
+		{"price any \"1 x\"", "error: invalid number x", nil},
+		{"price any \"\"", "error: invalid number ", nil},
+		{"id = 9007199254740993", "id = $1", []any{int64(9007199254740993)}},
+		{"id > -5", "id > $1", []any{int64(-5)}},
+		{"id = 1.5", "error: invalid integer 1.5", nil},
+		{"id = 9223372036854775808", "error: number 9223372036854775808 out of range for integer", nil},
+		{"id any \"1 9007199254740993\"", "id = ANY($1::bigint[])", []any{[]int64{1, 9007199254740993}}},
+		{"id within \"1 10\"", "id BETWEEN $1 AND $2", []any{int64(1), int64(10)}},
+		{"amount = 12.10", "amount = $1::numeric", []any{"12.10"}},
+		{"amount >= 1e2", "amount >= $1::numeric", []any{"1e2"}},
+		{"amount = 1000.51", "error: number 1000.51 out of range, it should be between 0 and 1000.5", nil},
+		{"amount = -0.01", "error: number -0.01 out of range, it should be between 0 and 1000.5", nil},
+		{"amount = 12,10", "error: invalid number 12,10", nil},
+		{"amount any \"1.10 2.20\"", "amount = ANY($1::numeric[])", []any{[]string{"1.10", "2.20"}}},
+		{"amount within \"1.5 2.5\"", "amount BETWEEN $1::numeric AND $2::numeric", []any{"1.5", "2.5"}},
+		{"percent = 100", "percent = $1", []any{100.0}},
+		{"percent = 100.01", "error: number 100.01 out of range, it should be between 0 and 100", nil},
+		{"rate = 0.1", "rate = $1::numeric", []any{"0.1"}},
+		{"rate = 0.10", "rate = $1::numeric", []any{"0.10"}},
+		{"rate any \"0.1 5\"", "rate = ANY($1::numeric[])", []any{[]string{"0.1", "5"}}},
+		{"rate = 0.09", "error: number 0.09 out of range, it should be between 0.1 and 100", nil},
+		{"ratio within \"0.1 0.3\"", "ratio BETWEEN $1 AND $2", []any{0.1, 0.3}},
+		{"ratio = 0.3000001", "error: number 0.3000001 out of range, it should be between 0.1 and 0.3", nil},
+		{"big = 9007199254740993", "big = $1", []any{int64(9007199254740993)}},
+		{"big = -9007199254740993", "big = $1", []any{int64(-9007199254740993)}},
+		{"big = 9007199254740994", "error: number 9007199254740994 out of range, it should be between -9007199254740993 and 9007199254740993", nil},
 		{"date = 2026-03-05", "date = $1", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}},
 		{"date == 2026-03-05", "date = $1", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}},
 		{"date exact 2026-03-05", "date = $1", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}},
@@ -235,8 +309,12 @@ func TestParsing(t *testing.T) {
 		{"date < 2026-03-05", "date < $1", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}},
 		{"date >= 2026-03-05", "date >= $1", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}},
 		{"date <= 2026-03-05", "date <= $1", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}},
-		{"date = April", "error: invalid date April, it should be in format YYYY-MM-DD", nil},
-		{"date all 2026-03-05", "error: unsupported relation all", nil},
+		{"date = April", "error: invalid date April, it should be in format YYYY-MM-DD, YYYY-MM, YYYY, YYYY-Www-D with isoDate, or relative such as today or now-7d", nil},
+		{"date all 2026-03-05", "date = ALL($1::date[])", []any{[]time.Time{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}}},
+		{"date any \"2026-03-05 2026-03-06\"", "date = ANY($1::date[])", []any{[]time.Time{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)}}},
+		{"date <> \"2026-03-05 2026-03-06\"", "date <> ALL($1::date[])", []any{[]time.Time{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)}}},
+		{"date any \"2026-03-05 2026\"", "error: partial date 2026 unsupported in list", nil},
+		{"date any \"2026-03-05 x\"", "error: invalid date x, it should be in format YYYY-MM-DD, YYYY-MM, YYYY, YYYY-Www-D with isoDate, or relative such as today or now-7d", nil},
 		{"date = \"\"", "date IS NOT NULL", []any{}},
 		{"datetime = 2026-03-05 09:34:27", "datetime = $1", []any{time.Date(2026, 3, 5, 9, 34, 27, 0, time.UTC)}},
 		{"datetime = 2026-03-05T09:34:27Z", "datetime = $1", []any{time.Date(2026, 3, 5, 9, 34, 27, 0, time.UTC)}},
@@ -248,8 +326,10 @@ func TestParsing(t *testing.T) {
 		{"datetime < 2026-03-05", "datetime < $1", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}},
 		{"datetime >= 2026-03-05", "datetime >= $1", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}},
 		{"datetime <= 2026-03-05", "datetime <= $1", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}},
-		{"datetime = April", "error: invalid date time April, it should be in format YYYY-MM-DD, YYYY-MM-DD HH:MM:SS, YYYY-MM-DDTHH:MM:SSZ, YYYY-MM-DDTHH:MM:SS±HH:MM", nil},
-		{"datetime all 2026-03-05", "error: unsupported relation all", nil},
+		{"datetime = April", "error: invalid date time April, it should be in format YYYY-MM-DD, YYYY-MM-DD HH:MM:SS, YYYY-MM-DDTHH:MM:SSZ, YYYY-MM-DDTHH:MM:SS±HH:MM, YYYY-MM, YYYY, YYYY-Www-D with isoDate, or relative such as today or now-7d", nil},
+		{"datetime all 2026-03-05", "datetime = ALL($1::timestamptz[])", []any{[]time.Time{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}}},
+		{"datetime <> \"2026-03-05 09:34:27\"", "datetime <> $1", []any{time.Date(2026, 3, 5, 9, 34, 27, 0, time.UTC)}},
+		{"datetime <> \"2026-03-05T09:34:27Z 2026-03-06\"", "datetime <> ALL($1::timestamptz[])", []any{[]time.Time{time.Date(2026, 3, 5, 9, 34, 27, 0, time.UTC), time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)}}},
 		{"datetime = \"\"", "datetime IS NOT NULL", []any{}},
 		{"bool = true", "bool = $1", []any{true}},
 		{"bool = TRUE", "bool = $1", []any{true}},
@@ -262,6 +342,10 @@ func TestParsing(t *testing.T) {
 		{"bool = no", "bool = $1", []any{false}},
 		{"bool > true", "error: unsupported relation >", nil},
 		{"bool = T", "error: invalid bool T", nil},
+		{"bool any \"true no\"", "bool = ANY($1::boolean[])", []any{[]bool{true, false}}},
+		{"bool all yes", "bool = ALL($1::boolean[])", []any{[]bool{true}}},
+		{"bool <> \"true false\"", "bool <> ALL($1::boolean[])", []any{[]bool{true, false}}},
+		{"bool any \"true T\"", "error: invalid bool T", nil},
 		{"tsvector = abc", "tsvector @@ to_tsquery('english', $1)", []any{"'abc'"}},
 		{"tsvector = \"abc\"", "tsvector @@ to_tsquery('english', $1)", []any{"'abc'"}},
 		{"tsvector = \"abc \"", "tsvector @@ to_tsquery('english', $1)", []any{"'abc'"}},
@@ -273,6 +357,118 @@ func TestParsing(t *testing.T) {
 		{"tsvector=\"a*\"", "tsvector @@ to_tsquery('english', $1)", []any{"'a':*"}},
 		{"tsvector=\"a*b\"", "error: masking op * supported only at end of term", nil},
 		{"tsvector > x", "error: unsupported relation >", nil},
+		{"fuzzy =/fuzzy abc", "Title % $1", []any{"abc"}},
+		{"fuzzy =/cql.fuzzy abc", "Title % $1", []any{"abc"}},
+		{"fuzzy <>/fuzzy abc", "NOT (Title % $1)", []any{"abc"}},
+		{"fuzzy >/fuzzy abc", "error: unsupported relation >", nil},
+		{"fuzzy =/fuzzy \"a*\"", "error: masking op * unsupported", nil},
+		{"fuzzy = abc", "Title = $1", []any{"abc"}},
+		{"fuzzy =/phonetic abc", "error: unsupported modifier phonetic", nil},
+		{"title =/fuzzy abc", "error: unsupported modifier fuzzy", nil},
+		{"fuzzyRank =/fuzzy abc", "similarity(Title, $1) > 0.4 ORDER BY similarity(Title, $1) DESC", []any{"abc"}},
+		{"title = a and fuzzyRank =/fuzzy abc sortby title", "Title = $1 AND similarity(Title, $2) > 0.4 ORDER BY Title, similarity(Title, $2) DESC", []any{"a", "abc"}},
+		{"fuzzyRank <>/fuzzy abc", "NOT (similarity(Title, $1) > 0.4)", []any{"abc"}},
+		{"title = a not fuzzyRank =/fuzzy abc", "Title = $1 AND NOT similarity(Title, $2) > 0.4", []any{"a", "abc"}},
+		{"title = a not (title = b or fuzzyRank =/phonetic abc)", "Title = $1 AND NOT (Title = $2 OR dmetaphone(Title) = dmetaphone($3))", []any{"a", "b", "abc"}},
+		{"fuzzyRank =/fuzzy abc not title = a", "similarity(Title, $1) > 0.4 AND NOT Title = $2 ORDER BY similarity(Title, $1) DESC", []any{"abc", "a"}},
+		{"fuzzyRank =/phonetic abc", "dmetaphone(Title) = dmetaphone($1) ORDER BY similarity(Title, $1) DESC", []any{"abc"}},
+		{"soundex =/phonetic abc", "soundex(Author) = soundex($1)", []any{"abc"}},
+		{"soundex <>/phonetic abc", "soundex(Author) <> soundex($1)", []any{"abc"}},
+		{"soundex all/phonetic abc", "error: unsupported relation all", nil},
+		{"price within \"10 20.5\"", "price BETWEEN $1 AND $2", []any{10.0, 20.5}},
+		{"price within \"10\"", "error: invalid range 10, it should be two values separated by space", nil},
+		{"price within \"10 x\"", "error: invalid number x", nil},
+		{"price encloses \"10 20\"", "error: unsupported relation encloses", nil},
+		{"date within \"2026-03-01 2026-03-31\"", "date BETWEEN $1 AND $2", []any{time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)}},
+		{"date within \"2026-03-01 March\"", "error: invalid date March, it should be in format YYYY-MM-DD, YYYY-MM, YYYY, YYYY-Www-D with isoDate, or relative such as today or now-7d", nil},
+		{"years = 1990", "years @> int4range($1, $2, '[]')", []any{int64(1990), int64(1990)}},
+		{"years = \"1990 2000\"", "years = int4range($1, $2, '[]')", []any{int64(1990), int64(2000)}},
+		{"years == 1990", "years = int4range($1, $2, '[]')", []any{int64(1990), int64(1990)}},
+		{"years <> \"1990 2000\"", "years <> int4range($1, $2, '[]')", []any{int64(1990), int64(2000)}},
+		{"years =/partial \"1990 2000\"", "years && int4range($1, $2, '[]')", []any{int64(1990), int64(2000)}},
+		{"years within \"1990 2000\"", "years <@ int4range($1, $2, '[]')", []any{int64(1990), int64(2000)}},
+		{"years within/partial \"1990 2000\"", "years && int4range($1, $2, '[]')", []any{int64(1990), int64(2000)}},
+		{"years encloses \"1990 2000\"", "years @> int4range($1, $2, '[]')", []any{int64(1990), int64(2000)}},
+		{"years encloses/partial 1990", "years && int4range($1, $2, '[]')", []any{int64(1990), int64(1990)}},
+		{"years < 1990", "years << int4range($1, $2, '[]')", []any{int64(1990), int64(1990)}},
+		{"years > 1990", "years >> int4range($1, $2, '[]')", []any{int64(1990), int64(1990)}},
+		{"years <= 1990", "years &< int4range($1, $2, '[]')", []any{int64(1990), int64(1990)}},
+		{"years >= 1990", "years &> int4range($1, $2, '[]')", []any{int64(1990), int64(1990)}},
+		{"years = \"\"", "years IS NOT NULL", []any{}},
+		{"years = 19.5", "error: invalid integer 19.5", nil},
+		{"years = \"1 2 3\"", "error: invalid range 1 2 3, it should be two values separated by space", nil},
+		{"years adj 1990", "error: unsupported relation adj", nil},
+		{"amounts within \"1.5 2.5\"", "amounts <@ numrange($1, $2, '[]')", []any{1.5, 2.5}},
+		{"period encloses 2026-03-05", "period @> daterange($1, $2, '[]')", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}},
+		{"period encloses 2026-03-05T10:00:00Z", "error: invalid date 2026-03-05T10:00:00Z, it should be in format YYYY-MM-DD, YYYY-MM, YYYY, YYYY-Www-D with isoDate, or relative such as today or now-7d", nil},
+		{"period within \"2020 2021\"", "period <@ daterange($1, $2, '[)')", []any{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{"period within \"2020-02 2026-03-05\"", "period <@ daterange($1, $2, '[]')", []any{time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}},
+		{"period encloses 2020-02", "period @> daterange($1, $2, '[)')", []any{time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)}},
+		{"during within \"2026-03-05T10:00:00Z 2026\"", "during <@ tstzrange($1, $2, '[)')", []any{time.Date(2026, 3, 5, 10, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{"during = \"2026-03-05 09:34:27\"", "during @> tstzrange($1, $2, '[]')", []any{time.Date(2026, 3, 5, 9, 34, 27, 0, time.UTC), time.Date(2026, 3, 5, 9, 34, 27, 0, time.UTC)}},
+		{"date = 2026", "(date >= $1 AND date < $2)", []any{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{"date == 2026-03", "(date >= $1 AND date < $2)", []any{time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)}},
+		{"date <> 2026-12", "(date < $1 OR date >= $2)", []any{time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{"date < 2026", "date < $1", []any{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{"date >= 2026", "date >= $1", []any{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{"date > 2026", "date >= $1", []any{time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{"date <= 2026", "date < $1", []any{time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{"date within \"2020 2026-02\"", "(date >= $1 AND date < $2)", []any{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)}},
+		{"date = 2026-13", "error: invalid date 2026-13, it should be in format YYYY-MM-DD, YYYY-MM, YYYY, YYYY-Www-D with isoDate, or relative such as today or now-7d", nil},
+		{"datetime = 2026", "(datetime >= $1 AND datetime < $2)", []any{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{"datetime = 2026-03-05T09:34:27.25Z", "datetime = $1", []any{time.Date(2026, 3, 5, 9, 34, 27, 250000000, time.UTC)}},
+		{"datetime = 2026-03-05T09:34:27.25", "error: invalid date time 2026-03-05T09:34:27.25, it should be in format YYYY-MM-DD, YYYY-MM-DD HH:MM:SS, YYYY-MM-DDTHH:MM:SSZ, YYYY-MM-DDTHH:MM:SS±HH:MM, YYYY-MM, YYYY, YYYY-Www-D with isoDate, or relative such as today or now-7d", nil},
+		{"datetime =/isoDate 2026-03-05T09:34:27.25", "datetime = $1", []any{time.Date(2026, 3, 5, 9, 34, 27, 250000000, time.UTC)}},
+		{"datetime =/isoDate 2020-W05", "(datetime >= $1 AND datetime < $2)", []any{time.Date(2020, 1, 27, 0, 0, 0, 0, time.UTC), time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC)}},
+		{"datetime >=/isoDate 2020-W05-3", "datetime >= $1", []any{time.Date(2020, 1, 29, 0, 0, 0, 0, time.UTC)}},
+		{"datetime =/isoDate 2026W10", "(datetime >= $1 AND datetime < $2)", []any{time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)}},
+		{"datetime =/isoDate 2026-W54", "error: invalid date time 2026-W54, it should be in format YYYY-MM-DD, YYYY-MM-DD HH:MM:SS, YYYY-MM-DDTHH:MM:SSZ, YYYY-MM-DDTHH:MM:SS±HH:MM, YYYY-MM, YYYY, YYYY-Www-D with isoDate, or relative such as today or now-7d", nil},
+		{"datetime = 2020-W05", "error: invalid date time 2020-W05, it should be in format YYYY-MM-DD, YYYY-MM-DD HH:MM:SS, YYYY-MM-DDTHH:MM:SSZ, YYYY-MM-DDTHH:MM:SS±HH:MM, YYYY-MM, YYYY, YYYY-Www-D with isoDate, or relative such as today or now-7d", nil},
+		{"local = \"2026-03-05 09:34:27\"", "datetime = $1", []any{time.Date(2026, 3, 5, 9, 34, 27, 0, berlin)}},
+		{"local = 2026-03-05T09:34:27Z", "datetime = $1", []any{time.Date(2026, 3, 5, 9, 34, 27, 0, time.UTC)}},
+		{"local >= now", "datetime >= $1", []any{time.Date(2026, 3, 5, 23, 30, 0, 0, berlin)}},
+		{"local >= NOW-7d", "datetime >= $1", []any{time.Date(2026, 2, 26, 23, 30, 0, 0, berlin)}},
+		{"local < now+2h", "datetime < $1", []any{time.Date(2026, 3, 6, 1, 30, 0, 0, berlin)}},
+		{"local >= today", "datetime >= $1", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, berlin)}},
+		{"local >= today-1M", "datetime >= $1", []any{time.Date(2026, 2, 5, 0, 0, 0, 0, berlin)}},
+		{"local >= now-1x", "error: invalid date time now-1x, it should be in format YYYY-MM-DD, YYYY-MM-DD HH:MM:SS, YYYY-MM-DDTHH:MM:SSZ, YYYY-MM-DDTHH:MM:SS±HH:MM, YYYY-MM, YYYY, YYYY-Www-D with isoDate, or relative such as today or now-7d", nil},
+		{"localDate = today", "date = $1", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}},
+		{"localDate > now-1w", "date > $1", []any{time.Date(2026, 2, 26, 0, 0, 0, 0, time.UTC)}},
+		{"during within \"2026-03-05 2026-03-06T12:00:00Z\"", "during <@ tstzrange($1, $2, '[]')", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 6, 12, 0, 0, 0, time.UTC)}},
+		{"title <> \"\"", "Title <> $1", []any{""}},
+		{"contributor = knuth*", "EXISTS (SELECT 1 FROM contributors r1 WHERE r1.instance_id = instance.id AND r1.name LIKE $1)", []any{"knuth%"}},
+		{"contributor = \"\"", "EXISTS (SELECT 1 FROM contributors r1 WHERE r1.instance_id = instance.id AND r1.name IS NOT NULL)", []any{}},
+		{"barcode = 123 and contributorType = author", "EXISTS (SELECT 1 FROM holdings r2 WHERE r2.instance_id = instance.id AND r2.barcode = $1) AND " +
+			"EXISTS (SELECT 1 FROM contributors r1 WHERE r1.instance_id = instance.id AND r1.type = $2)", []any{"123", "author"}},
+		{"holdingsCity = Reading", "EXISTS (SELECT 1 FROM holdings h WHERE h.instance_id = instance.id AND h.doc->>'city' = $1)", []any{"Reading"}},
+		{"barcode = 1 sortby contributor", "error: field contributor does not support sorting", []any{}},
+		{"barcode > 1", "error: unsupported relation >", []any{}},
+		{"contributor.name = smith", "EXISTS (SELECT 1 FROM contributors r1 WHERE r1.instance_id = instance.id AND r1.name = $1)", []any{"smith"}},
+		{"contributor.name = smith and contributor.role = editor",
+			"EXISTS (SELECT 1 FROM contributors r1 WHERE r1.instance_id = instance.id AND (r1.name = $1 AND r1.role = $2))", []any{"smith", "editor"}},
+		{"contributor.name = smith not (contributor.role = editor or contributor.role = author)",
+			"EXISTS (SELECT 1 FROM contributors r1 WHERE r1.instance_id = instance.id AND r1.name = $1) AND " +
+				"NOT EXISTS (SELECT 1 FROM contributors r1 WHERE r1.instance_id = instance.id AND (r1.role = $2 OR r1.role = $3))",
+			[]any{"smith", "editor", "author"}},
+		{"contributor.name = smith and contributor.role = editor not contributor.role = author",
+			"EXISTS (SELECT 1 FROM contributors r1 WHERE r1.instance_id = instance.id AND (r1.name = $1 AND r1.role = $2)) AND " +
+				"NOT EXISTS (SELECT 1 FROM contributors r1 WHERE r1.instance_id = instance.id AND r1.role = $3)",
+			[]any{"smith", "editor", "author"}},
+		{"contributor.name = smith and title = a and contributor.role = editor",
+			"EXISTS (SELECT 1 FROM contributors r1 WHERE r1.instance_id = instance.id AND (r1.name = $1 AND r1.role = $2)) AND Title = $3",
+			[]any{"smith", "editor", "a"}},
+		{"title = a and (contributor.name = smith and barcode = 1) and contributor.role = editor",
+			"(Title = $1 AND EXISTS (SELECT 1 FROM contributors r1 WHERE r1.instance_id = instance.id AND (r1.name = $2 AND r1.role = $3))) AND " +
+				"EXISTS (SELECT 1 FROM holdings r2 WHERE r2.instance_id = instance.id AND r2.barcode = $4)",
+			[]any{"a", "smith", "editor", "1"}},
+		{"contributor.name = smith or contributor.role = editor and title = a",
+			"EXISTS (SELECT 1 FROM contributors r1 WHERE r1.instance_id = instance.id AND (r1.name = $1 OR r1.role = $2)) AND Title = $3",
+			[]any{"smith", "editor", "a"}},
+		{"contributor.name = smith or title = a",
+			"EXISTS (SELECT 1 FROM contributors r1 WHERE r1.instance_id = instance.id AND r1.name = $1) OR Title = $2", []any{"smith", "a"}},
+		{"contributor.name = smith and contributor.title = a", "error: field group contributor must consist of related fields of the same table", []any{}},
+		{"price <> \"\"", "error: invalid number ", []any{}},
+		{"title == \"\"", "Title = $1", []any{""}},
 	} {
 		var parser cql.Parser
 		q, err := parser.Parse(testcase.query)
@@ -307,3 +503,1368 @@ func TestParsing(t *testing.T) {
 		}
 	}
 }
+
+type legacyField struct {
+	FieldCommon
+}
+
+func (f *legacyField) Generate(sc cql.SearchClause, queryArgumentIndex int) (string, []any, error) {
+	return fmt.Sprintf("(%s = $%d OR %s = $%d || '$%d') AND $%d <> ''", f.column, queryArgumentIndex, f.column,
+		queryArgumentIndex+1, queryArgumentIndex, queryArgumentIndex), []any{sc.Term, sc.Term + "x"}, nil
+}
+
+// sqlField is a custom field generating the given SQL, which uses $1 and $2 for queryArgumentIndex 1.
+type sqlField struct {
+	FieldCommon
+	sql string
+}
+
+func (f *sqlField) Generate(sc cql.SearchClause, queryArgumentIndex int) (string, []any, error) {
+	return f.sql, []any{sc.Term, sc.Term + "%"}, nil
+}
+
+func TestExpr(t *testing.T) {
+	def := NewDefinition()
+	def.AddField("title", NewFieldString().WithExact())
+	def.AddField("legacy", &legacyField{})
+	def.AddField("fuzzy", NewFieldString().WithFuzzy(0).WithFuzzyRank())
+
+	var parser cql.Parser
+	q, err := parser.Parse("title = a or legacy = b")
+	assert.NoError(t, err)
+	pgQuery, err := def.ParseContext(context.Background(), q, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "title = $3 OR (legacy = $4 OR legacy = $5 || '$1') AND $4 <> ''", pgQuery.GetWhereClause())
+	assert.Equal(t, []any{"a", "b", "bx"}, pgQuery.GetQueryArguments())
+
+	where, ok := pgQuery.GetWhereExpr().(*Bool)
+	assert.True(t, ok)
+	assert.Equal(t, OpOr, where.Op)
+	assert.Equal(t, Seq{Text("title = "), &Param{Value: "a"}}, where.Left)
+
+	// swap the operands and render again
+	sql, args := RenderExpr(&Bool{Op: OpAnd, Left: where.Right, Right: &Not{Expr: &Paren{Expr: where.Left}}}, 1)
+	assert.Equal(t, "(legacy = $1 OR legacy = $2 || '$1') AND $1 <> '' AND NOT (title = $3)", sql)
+	assert.Equal(t, []any{"b", "bx", "a"}, args)
+
+	q, err = parser.Parse("title = a and fuzzy =/fuzzy b")
+	assert.NoError(t, err)
+	pgQuery, err = def.ParseContext(context.Background(), q, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "title = $1 AND fuzzy % $2 ORDER BY similarity(fuzzy, $2) DESC", pgQuery.GetWhereClause()+pgQuery.GetOrderByClause())
+	assert.Equal(t, []any{"a", "b"}, pgQuery.GetQueryArguments())
+
+	// custom fields generate the same SQL through the expression tree, placeholders in literals included
+	for _, testcase := range []struct {
+		sql string
+		err string
+	}{
+		{sql: "(e = $1 OR e LIKE E'\\'$1' || $2)"},
+		{sql: "e = $1 AND e LIKE e'\\\\' || $2 AND x <> 'it''s $1'"},
+		{sql: "e = $1 AND \"$1\" LIKE $2 AND e <> $$ $1 $$ AND e <> $a$ '$1 $a$"},
+		{sql: "e$1 = $1 AND e LIKE $2"},
+		{sql: "e = $1 AND e LIKE $3", err: "placeholder $3 has no argument"},
+		{sql: "e = $1 AND e LIKE '$2'", err: "argument 2 has no placeholder $2"},
+	} {
+		def := NewDefinition()
+		def.AddField("e", &sqlField{sql: testcase.sql})
+		q, err := parser.Parse("e = b")
+		assert.NoError(t, err)
+		pgQuery, err := def.ParseContext(context.Background(), q, 1)
+		if testcase.err != "" {
+			assert.EqualError(t, err, testcase.err, testcase.sql)
+			continue
+		}
+		assert.NoError(t, err, testcase.sql)
+		expected, expectedArgs, err := (&sqlField{sql: testcase.sql}).Generate(cql.SearchClause{Term: "b"}, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, pgQuery.GetWhereClause(), testcase.sql)
+		assert.Equal(t, expectedArgs, pgQuery.GetQueryArguments(), testcase.sql)
+	}
+	def.AddField("escape", &sqlField{sql: "(escape = $1 OR escape LIKE E'\\'$1' || $2)"})
+	q, err = parser.Parse("title = a and escape = b")
+	assert.NoError(t, err)
+	pgQuery, err = def.ParseContext(context.Background(), q, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "title = $3 AND (escape = $4 OR escape LIKE E'\\'$1' || $5)", pgQuery.GetWhereClause())
+	assert.Equal(t, []any{"a", "b", "b%"}, pgQuery.GetQueryArguments())
+
+	sql, args, err = NewFieldNumber().WithDecimal().WithColumn("amount").Generate(cql.SearchClause{Index: "amount", Relation: cql.WITHIN, Term: "1 2"}, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, "amount BETWEEN $7::numeric AND $8::numeric", sql)
+	assert.Equal(t, []any{"1", "2"}, args)
+}
+
+func TestRender(t *testing.T) {
+	def := NewDefinition()
+	def.AddField("title", NewFieldString().WithExact())
+	def.AddField("year", NewFieldNumber().WithInteger())
+	def.AddField("fuzzy", NewFieldString().WithFuzzy(0).WithFuzzyRank())
+
+	var parser cql.Parser
+	q, err := parser.Parse("fuzzy =/fuzzy a and (title = b or year any \"1 2\") sortby title")
+	assert.NoError(t, err)
+	pgQuery, err := def.ParseContext(context.Background(), q, 1)
+	assert.NoError(t, err)
+
+	res := pgQuery.Render(RenderOptions{Index: 3})
+	assert.Equal(t, "fuzzy % $3 AND (title = $4 OR year = ANY($5::bigint[]))", res.WhereClause)
+	assert.Equal(t, " ORDER BY title, similarity(fuzzy, $3) DESC", res.OrderByClause)
+	assert.Equal(t, []string{"title"}, res.OrderByFields)
+	assert.Equal(t, []any{"a", "b", []int64{1, 2}}, res.Arguments)
+	assert.Nil(t, res.NamedArguments)
+
+	res = pgQuery.Render(RenderOptions{Style: PlaceholderQuestion})
+	assert.Equal(t, "fuzzy % ? AND (title = ? OR year = ANY(?::bigint[]))", res.WhereClause)
+	assert.Equal(t, " ORDER BY title, similarity(fuzzy, ?) DESC", res.OrderByClause)
+	assert.Equal(t, []any{"a", "b", []int64{1, 2}, "a"}, res.Arguments)
+
+	res = pgQuery.Render(RenderOptions{Style: PlaceholderNamed, NamePrefix: "q"})
+	assert.Equal(t, "fuzzy % @q1 AND (title = @q2 OR year = ANY(@q3::bigint[]))", res.WhereClause)
+	assert.Equal(t, " ORDER BY title, similarity(fuzzy, @q1) DESC", res.OrderByClause)
+	assert.Equal(t, []any{"a", "b", []int64{1, 2}}, res.Arguments)
+	assert.Equal(t, map[string]any{"q1": "a", "q2": "b", "q3": []int64{1, 2}}, res.NamedArguments)
+
+	// the query itself is unchanged
+	assert.Equal(t, "fuzzy % $1 AND (title = $2 OR year = ANY($3::bigint[]))", pgQuery.GetWhereClause())
+	assert.Equal(t, " ORDER BY title, similarity(fuzzy, $1) DESC", pgQuery.GetOrderByClause())
+
+	sql, args, named := RenderExprWith(pgQuery.GetWhereExpr(), RenderOptions{Style: PlaceholderNamed})
+	assert.Equal(t, "fuzzy % @p1 AND (title = @p2 OR year = ANY(@p3::bigint[]))", sql)
+	assert.Equal(t, []any{"a", "b", []int64{1, 2}}, args)
+	assert.Equal(t, map[string]any{"p1": "a", "p2": "b", "p3": []int64{1, 2}}, named)
+}
+
+type tenantKey struct{}
+
+func TestScope(t *testing.T) {
+	def := NewDefinition()
+	def.AddField("title", NewFieldString().WithExact())
+	def.AddField("year", NewFieldNumber())
+	def.AddFacet("year", NewFacet())
+	def.AddScope("visible OR owner = $1", "bob")
+	def.AddScopeFunc(func(ctx context.Context) (Expr, error) {
+		tenant, ok := ctx.Value(tenantKey{}).(string)
+		if !ok {
+			return nil, fmt.Errorf("no tenant")
+		}
+		return Seq{Text("tenant_id = "), &Param{Value: tenant}}, nil
+	})
+	ctx := context.WithValue(context.Background(), tenantKey{}, "t1")
+
+	var parser cql.Parser
+	for _, testcase := range []struct {
+		query        string
+		expected     string
+		expectedArgs []any
+	}{
+		{"title = a", "(visible OR owner = $3) AND (tenant_id = $4) AND (title = $5)", []any{"bob", "t1", "a"}},
+		{"title = a or year > 1", "(visible OR owner = $3) AND (tenant_id = $4) AND (title = $5 OR year > $6)", []any{"bob", "t1", "a", 1.0}},
+		{"title = a not year > 1", "(visible OR owner = $3) AND (tenant_id = $4) AND (title = $5 AND NOT year > $6)", []any{"bob", "t1", "a", 1.0}},
+	} {
+		q, err := parser.Parse(testcase.query)
+		assert.NoError(t, err, testcase.query)
+		pgQuery, err := def.ParseContext(ctx, q, 3)
+		assert.NoError(t, err, testcase.query)
+		assert.Equal(t, testcase.expected, pgQuery.GetWhereClause(), testcase.query)
+		assert.Equal(t, testcase.expectedArgs, pgQuery.GetQueryArguments(), testcase.query)
+	}
+
+	q, err := parser.Parse("title = a")
+	assert.NoError(t, err)
+	_, err = def.Parse(q, 1)
+	assert.EqualError(t, err, "no tenant")
+
+	facets, err := def.GenerateFacets(ctx, q, "mytable", []string{"year"}, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT (year)::text AS value, count(*) AS count FROM mytable "+
+		"WHERE ((visible OR owner = $1) AND (tenant_id = $2) AND (title = $3)) AND (year) IS NOT NULL GROUP BY 1 ORDER BY count DESC, value LIMIT $4", facets[0].SQL)
+	assert.Equal(t, []any{"bob", "t1", "a", 5}, facets[0].Arguments)
+
+	scan, err := def.GenerateScan(ctx, "title = m", "mytable", 2, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT (title)::text AS term, count(*) AS count FROM mytable WHERE (title) IS NOT NULL AND (title) < $1 "+
+		"AND (visible OR owner = $2) AND (tenant_id = $3) GROUP BY (title) ORDER BY (title) DESC LIMIT $4", scan.Before.SQL)
+	assert.Equal(t, []any{"m", "bob", "t1", 1}, scan.Before.Arguments)
+	_, err = def.GenerateScan(context.Background(), "title = m", "mytable", 1, 3)
+	assert.EqualError(t, err, "no tenant")
+
+	bad := NewDefinition()
+	bad.AddField("title", NewFieldString().WithExact())
+	bad.AddScope("owner = $2", "bob")
+	_, err = bad.Parse(q, 1)
+	assert.EqualError(t, err, "placeholder $2 has no argument")
+
+	// scope functions are called without the lock of the definition, so they may use it
+	lazy := NewDefinition()
+	lazy.AddField("title", NewFieldString().WithExact())
+	lazy.AddScopeFunc(func(ctx context.Context) (Expr, error) {
+		if lazy.GetFieldType("owner") == nil {
+			lazy.AddField("owner", NewFieldString().WithExact())
+		}
+		return lazy.GetFieldType("owner").(*FieldString).GenerateExpr(cql.SearchClause{Index: "owner", Relation: cql.EQ, Term: "bob"})
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pgQuery, err := lazy.ParseContext(ctx, q, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "(owner = $1) AND (title = $2)", pgQuery.GetWhereClause())
+		_, err = lazy.GenerateFacets(ctx, q, "mytable", nil, 5)
+		assert.NoError(t, err)
+		_, err = lazy.GenerateScan(ctx, "title = m", "mytable", 1, 3)
+		assert.NoError(t, err)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scope function deadlocked")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	def := NewDefinition()
+	def.AddField("title", NewFieldString().WithLikeOps())
+	def.AddField("ssn", NewFieldString().WithExact())
+	def.AddField("year", NewFieldNumber())
+	def.AddField("anywhere", NewFieldCombo(true, []Field{NewFieldString().WithColumn("title").WithLikeOps(), NewFieldString().WithColumn("ssn").WithExact()}))
+	def.AddField("keyword", NewFieldCombo(true, []Field{NewFieldString().WithColumn("title").WithLikeOps(), NewFieldNumber().WithColumn("year")}))
+	def.AddField("barcode", NewFieldRelated("holdings", "instance_id", "instance.id", NewFieldString().WithExact()))
+	def.AddFacet("ssn", NewFacet())
+	def.AddFacet("year", NewFacet())
+	def.AddFacet("identifier", NewFacet().WithColumn("ssn"))
+
+	patron := &Policy{
+		DeniedFields:        []string{"SSN"},
+		DeniedRelations:     []cql.Relation{cql.NE},
+		DeniedModifiers:     []string{"fuzzy"},
+		DenyLeadingWildcard: true,
+		PrefixWildcardOnly:  true,
+		DeniedSortFields:    []string{"year"},
+		MaxClauses:          3,
+		MaxDepth:            2,
+		MaxSortKeys:         1,
+	}
+	ctx := WithPolicy(context.Background(), patron)
+	assert.Equal(t, patron, PolicyFromContext(ctx))
+	assert.Nil(t, PolicyFromContext(context.Background()))
+
+	var parser cql.Parser
+	for _, testcase := range []struct {
+		query    string
+		expected string
+	}{
+		{"title = comp*", ""},
+		{"title = \\*comp", ""},
+		{"title = comp and year > 2000 or title = x", ""},
+		{"ssn = 123", "permission denied for ssn = 123: field ssn"},
+		{"title = a or ssn = 123", "permission denied for ssn = 123: field ssn"},
+		{"anywhere = 123", "permission denied for anywhere = 123: field anywhere"},
+		{"keyword = 123", ""},
+		{"barcode = 123", ""},
+		{"title <> a", "permission denied for title <> a: relation <>"},
+		{"title =/cql.fuzzy a", "permission denied for title =/cql.fuzzy a: modifier cql.fuzzy"},
+		{"title = *comp", "permission denied for title = *comp: leading wildcard"},
+		{"title = co*mp", "permission denied for title = co*mp: wildcard not at end of term"},
+		{"title = a and title = b and title = c and title = d", "permission denied: too many clauses, at most 3 allowed"},
+		{"title = a and (title = b or title = c)", ""},
+		{"title = a and (title = b or (title = c and title = d))", "permission denied: query too deep, at most 2 levels allowed"},
+		{"title = a sortby year", "permission denied for sortby year: sort by year"},
+		{"title = a sortby ssn/sort.descending", "permission denied for sortby ssn/sort.descending: sort by ssn"},
+		{"title = a sortby title title", "permission denied: too many sort keys, at most 1 allowed"},
+	} {
+		q, err := parser.Parse(testcase.query)
+		assert.NoError(t, err, testcase.query)
+		_, err = def.ParseContext(ctx, q, 1)
+		if testcase.expected == "" {
+			assert.NoError(t, err, testcase.query)
+			continue
+		}
+		assert.EqualError(t, err, testcase.expected, testcase.query)
+		var permissionError *PermissionError
+		assert.ErrorAs(t, err, &permissionError, testcase.query)
+	}
+
+	q, err := parser.Parse("ssn = 123")
+	assert.NoError(t, err)
+	_, err = def.Parse(q, 1)
+	assert.NoError(t, err)
+
+	staff := &Policy{AllowedFields: []string{"title", "ssn"}}
+	_, err = def.ParseContext(WithPolicy(context.Background(), staff), q, 1)
+	assert.NoError(t, err)
+	q, err = parser.Parse("year = 2000")
+	assert.NoError(t, err)
+	_, err = def.ParseContext(WithPolicy(context.Background(), staff), q, 1)
+	assert.EqualError(t, err, "permission denied for year = 2000: field year")
+
+	q, err = parser.Parse("title = a")
+	assert.NoError(t, err)
+	_, err = def.GenerateFacets(ctx, q, "mytable", []string{"year", "ssn"}, 10)
+	assert.EqualError(t, err, "permission denied: facet ssn")
+	_, err = def.GenerateFacets(ctx, q, "mytable", []string{"identifier"}, 10)
+	assert.EqualError(t, err, "permission denied: facet identifier")
+	_, err = def.GenerateScan(ctx, "ssn = 1", "mytable", 1, 10)
+	assert.EqualError(t, err, "permission denied for ssn = 1: field ssn")
+	_, err = def.GenerateScan(ctx, "title = a", "mytable", 1, 10)
+	assert.NoError(t, err)
+
+	columns := WithPolicy(context.Background(), &Policy{DeniedColumns: []string{"year", "Holdings.Barcode"}})
+	for _, testcase := range []struct {
+		query    string
+		expected string
+	}{
+		{"title = a", ""},
+		{"year = 2000", "permission denied for year = 2000: field year"},
+		{"keyword = a", "permission denied for keyword = a: field keyword"},
+		{"barcode = 123", "permission denied for barcode = 123: field barcode"},
+		{"title = a sortby year", "permission denied for sortby year: sort by year"},
+	} {
+		q, err := parser.Parse(testcase.query)
+		assert.NoError(t, err, testcase.query)
+		_, err = def.ParseContext(columns, q, 1)
+		if testcase.expected == "" {
+			assert.NoError(t, err, testcase.query)
+			continue
+		}
+		assert.EqualError(t, err, testcase.expected, testcase.query)
+	}
+	q, err = parser.Parse("title = a")
+	assert.NoError(t, err)
+	_, err = def.GenerateFacets(columns, q, "mytable", []string{"year"}, 10)
+	assert.EqualError(t, err, "permission denied: facet year")
+
+	// policy names are resolved with the context sets of the definition
+	const dc = "http://purl.org/dc/elements/1.1/"
+	dcDef := NewDefinition().WithContextSet("dc", dc).WithDefaultContextSet(dc)
+	dcDef.AddField("dc.title", NewFieldString().WithExact().WithColumn("title")).
+		AddField("dc.ssn", NewFieldString().WithExact().WithColumn("ssn")).
+		AddField("year", NewFieldNumber()).
+		AddField("anywhere", NewFieldCombo(true, []Field{NewFieldString().WithColumn("title").WithExact(), NewFieldString().WithColumn("ssn").WithExact()}))
+	for _, testcase := range []struct {
+		policy   *Policy
+		query    string
+		expected string
+	}{
+		{&Policy{DeniedFields: []string{"ssn"}}, "ssn = 1", "permission denied for dc.ssn = 1: field dc.ssn"},
+		{&Policy{DeniedFields: []string{"ssn"}}, "dc.ssn = 1", "permission denied for dc.ssn = 1: field dc.ssn"},
+		{&Policy{DeniedFields: []string{"dc.ssn"}}, "ssn = 1", "permission denied for dc.ssn = 1: field dc.ssn"},
+		{&Policy{DeniedFields: []string{"ssn"}}, "anywhere = 1", "permission denied for anywhere = 1: field anywhere"},
+		{&Policy{DeniedFields: []string{"ssn"}}, "title = 1", ""},
+		{&Policy{AllowedFields: []string{"title", "year"}}, "title = a and year = 1", ""},
+		{&Policy{AllowedFields: []string{"title"}}, "ssn = 1", "permission denied for dc.ssn = 1: field dc.ssn"},
+		{&Policy{DeniedSortFields: []string{"title"}}, "year = 1 sortby title", "permission denied for sortby dc.title: sort by dc.title"},
+	} {
+		q, err := parser.Parse(testcase.query)
+		assert.NoError(t, err, testcase.query)
+		_, err = dcDef.ParseContext(WithPolicy(context.Background(), testcase.policy), q, 1)
+		if testcase.expected == "" {
+			assert.NoError(t, err, testcase.query)
+			continue
+		}
+		assert.EqualError(t, err, testcase.expected, testcase.query)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	def := NewDefinition()
+	def.AddField("title", NewFieldString().WithLikeOps())
+	def.AddField("name", NewFieldString().WithILikeOps().WithTrigramIndex())
+	def.AddField("id", NewFieldNumber().WithInteger())
+	def.AddField("cql.serverChoice", NewFieldCombo(false, []Field{NewFieldString().WithColumn("title").WithLikeOps(), NewFieldString().WithColumn("name").WithExact()}))
+	def.AddField("code", NewFieldTemplate(TermString).WithTemplate(cql.EQ, "(upper({column}) = {arg} OR lower({column}) = {arg})"))
+	def.WithLimits(Limits{MaxArguments: 4, MaxOrFanOut: 3, DenyLeadingWildcard: true})
+
+	var parser cql.Parser
+	for _, testcase := range []struct {
+		query    string
+		expected error
+	}{
+		{"title = comp*", nil},
+		{"name = *comp", nil},
+		{"title = \\*comp", nil},
+		{"title = *comp", ErrLeadingWildcard},
+		{"title = ?omp", ErrLeadingWildcard},
+		{"*comp", ErrLeadingWildcard},
+		{"id any \"1 2 3 4\"", nil},
+		{"id any \"1 2 3 4 5\"", ErrMaxArguments},
+		{"code = a and code = b and id any \"1 2\"", nil},
+		{"code = a and code = b and id any \"1 2 3\"", ErrMaxArguments},
+		{"title = a or title = b or title = c", nil},
+		{"title = a or (title = b or title = c) or title = d", ErrMaxOrFanOut},
+		{"title = a and (title = b or title = c or title = d or title = e)", ErrMaxOrFanOut},
+		{"comp or title = b", nil},
+		{"comp or title = b or title = c", ErrMaxOrFanOut},
+	} {
+		q, err := parser.Parse(testcase.query)
+		assert.NoError(t, err, testcase.query)
+		_, err = def.Parse(q, 1)
+		if testcase.expected == nil {
+			assert.NoError(t, err, testcase.query)
+			continue
+		}
+		assert.ErrorIs(t, err, testcase.expected, testcase.query)
+		var pgError *PgError
+		assert.ErrorAs(t, err, &pgError, testcase.query)
+	}
+
+	q, err := parser.Parse("title = *comp")
+	assert.NoError(t, err)
+	_, err = def.Parse(q, 1)
+	assert.EqualError(t, err, "leading wildcard unsupported: title")
+	q, err = parser.Parse("id any \"1 2 3 4 5\"")
+	assert.NoError(t, err)
+	_, err = def.Parse(q, 1)
+	assert.EqualError(t, err, "too many query arguments, at most 4 allowed")
+
+	same := &Param{Value: "a"}
+	assert.Equal(t, 4, countArguments(Seq{same, Text(" AND "), same, &Param{Value: []int32{1, 2}}, &Param{Value: []byte("b")}}, make(map[*Param]bool)))
+}
+
+func TestNullPolicy(t *testing.T) {
+	def := NewDefinition().WithNullPolicy(NullNonMatch)
+	def.AddField("title", NewFieldString().WithExact()).
+		AddField("author", NewFieldString().WithLikeOps()).
+		AddField("authori", NewFieldString().WithILikeOps()).
+		AddField("tag", NewFieldString().WithExact().WithSplit()).
+		AddField("fuzzy", NewFieldString().WithFuzzy(0).WithPhonetic(PhoneticSoundex)).
+		AddField("name", NewFieldString().WithLikeOps().WithLower().WithNullPolicy(NullEmpty)).
+		AddField("sql", NewFieldString().WithExact().WithNullPolicy(NullSQL)).
+		AddField("price", NewFieldNumber()).
+		AddField("date", NewFieldDate().WithOnlyDate()).
+		AddField("bool", NewFieldBool()).
+		AddField("years", NewFieldRange(RangeInt4)).
+		AddField("any", NewFieldCombo(false, []Field{NewFieldString().WithExact().WithColumn("a"), NewFieldString().WithExact().WithColumn("b")}))
+	// fields added before the definition policy is changed get it too,
+	// without changing the field, which may be added to other definitions
+	later := NewFieldNumber()
+	def2 := NewDefinition()
+	def2.AddField("later", later)
+	def2.WithNullPolicy(NullNonMatch)
+	def3 := NewPgDefinition().AddField("later", later)
+	assert.Equal(t, NullSQL, later.nullPolicy)
+	for _, testcase := range []struct {
+		def      Definition
+		expected string
+	}{
+		{def2, "later IS DISTINCT FROM $1"},
+		{def3, "later <> $1"},
+	} {
+		pgQuery, err := testcase.def.Parse(cql.Query{Clause: cql.Clause{SearchClause: &cql.SearchClause{Index: "later", Relation: cql.NE, Term: "1"}}}, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, testcase.expected, pgQuery.GetWhereClause())
+	}
+
+	for _, testcase := range []struct {
+		query        string
+		expected     string
+		expectedArgs []any
+	}{
+		{"title <> a", "title IS DISTINCT FROM $1", []any{"a"}},
+		{"title = a", "title = $1", []any{"a"}},
+		{"title <> \"\"", "title <> $1", []any{""}},
+		{"sql <> \"\"", "sql <> $1", []any{""}},
+		{"price =/missing \"\"", "price IS NULL", []any{}},
+		{"title = \"\"", "title IS NOT NULL", []any{}},
+		{"title == \"\"", "title = $1", []any{""}},
+		{"author <> a*", "(author NOT LIKE $1 OR author IS NULL)", []any{"a%"}},
+		{"authori <> a*", "(authori NOT ILIKE $1 OR authori IS NULL)", []any{"a%"}},
+		{"tag <> \"a b\"", "(tag NOT IN($1, $2) OR tag IS NULL)", []any{"a", "b"}},
+		{"fuzzy <>/fuzzy a", "(NOT (fuzzy % $1) OR fuzzy IS NULL)", []any{"a"}},
+		{"fuzzy <>/phonetic a", "soundex(fuzzy) IS DISTINCT FROM soundex($1)", []any{"a"}},
+		{"name <> a*", "lower(COALESCE(name, '')) NOT LIKE lower($1)", []any{"a%"}},
+		{"name <> a", "lower(COALESCE(name, '')) IS DISTINCT FROM lower($1)", []any{"a"}},
+		{"name == \"\"", "lower(COALESCE(name, '')) = lower($1)", []any{""}},
+		{"sql <> a", "sql <> $1", []any{"a"}},
+		{"price <> 1", "price IS DISTINCT FROM $1", []any{1.0}},
+		{"price <> \"1 2\"", "(price <> ALL($1::float8[]) OR price IS NULL)", []any{[]float64{1, 2}}},
+		{"price > 1", "price > $1", []any{1.0}},
+		{"date <> 2026", "(date < $1 OR date >= $2 OR date IS NULL)",
+			[]any{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{"date <> 2026-03-05", "date IS DISTINCT FROM $1", []any{time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)}},
+		{"bool <> true", "bool IS DISTINCT FROM $1", []any{true}},
+		{"years <> \"1990 2000\"", "years IS DISTINCT FROM int4range($1, $2, '[]')", []any{int64(1990), int64(2000)}},
+		{"any <> x", "(a IS DISTINCT FROM $1 OR b IS DISTINCT FROM $2)", []any{"x", "x"}},
+		{"title = a not price = 1", "title = $1 AND NOT COALESCE(price = $2, FALSE)", []any{"a", 1.0}},
+		{"title = a not (price = 1 or bool = true)", "title = $1 AND NOT COALESCE((price = $2 OR bool = $3), FALSE)", []any{"a", 1.0, true}},
+	} {
+		var parser cql.Parser
+		q, err := parser.Parse(testcase.query)
+		assert.NoError(t, err, testcase.query)
+		pgQuery, err := def.Parse(q, 1)
+		assert.NoError(t, err, testcase.query)
+		assert.Equal(t, testcase.expected, pgQuery.GetWhereClause(), testcase.query)
+		assert.Equal(t, testcase.expectedArgs, pgQuery.GetQueryArguments(), testcase.query)
+	}
+
+	// empty terms mean the same under every policy
+	for _, policy := range []NullPolicy{NullSQL, NullNonMatch, NullEmpty} {
+		def := NewDefinition().WithNullPolicy(policy)
+		def.AddField("title", NewFieldString().WithExact()).
+			AddField("name", NewFieldString().WithLikeOps().WithLower()).
+			AddField("price", NewFieldNumber()).
+			AddField("date", NewFieldDate().WithOnlyDate())
+		for _, testcase := range []struct {
+			query        string
+			expected     string
+			expectedArgs []any
+		}{
+			{"title <> \"\"", "title <> $1", []any{""}},
+			{"name <> \"\"", "lower(name) <> lower($1)", []any{""}},
+			{"title = \"\"", "title IS NOT NULL", []any{}},
+			{"title =/missing \"\"", "title IS NULL", []any{}},
+			{"price =/missing \"\"", "price IS NULL", []any{}},
+			{"date =/missing \"\"", "date IS NULL", []any{}},
+			{"price <> \"\"", "error: invalid number ", []any{}},
+		} {
+			var parser cql.Parser
+			q, err := parser.Parse(testcase.query)
+			assert.NoError(t, err, testcase.query)
+			pgQuery, err := def.Parse(q, 1)
+			if strings.HasPrefix(testcase.expected, "error: ") {
+				assert.EqualError(t, err, testcase.expected[7:], testcase.query)
+				continue
+			}
+			assert.NoError(t, err, testcase.query)
+			assert.Equal(t, testcase.expected, pgQuery.GetWhereClause(), testcase.query)
+			assert.Equal(t, testcase.expectedArgs, pgQuery.GetQueryArguments(), testcase.query)
+		}
+	}
+}
+
+func TestFacets(t *testing.T) {
+	def := NewDefinition()
+	def.AddField("title", NewFieldString().WithExact())
+	def.AddField("year", NewFieldNumber())
+	def.AddFacet("year", NewFacet())
+	def.AddFacet("tags", NewFacet().WithArray())
+	def.AddFacet("city", NewFacet().WithColumn("address->>'city'"))
+	def.AddFacet("subjects", NewFacet().WithJsonbArray().WithColumn("doc->'subjects'"))
+
+	var parser cql.Parser
+	q, err := parser.Parse("title = a or year > 2000 sortby title")
+	assert.NoError(t, err)
+
+	facets, err := def.GenerateFacets(context.Background(), q, "mytable", []string{"year", "Tags", "city", "subjects"}, 10)
+	assert.NoError(t, err)
+	assert.Len(t, facets, 4)
+	assert.Equal(t, "year", facets[0].Name)
+	assert.Equal(t, "SELECT (year)::text AS value, count(*) AS count FROM mytable "+
+		"WHERE (title = $1 OR year > $2) AND (year) IS NOT NULL GROUP BY 1 ORDER BY count DESC, value LIMIT $3", facets[0].SQL)
+	assert.Equal(t, []any{"a", 2000.0, 10}, facets[0].Arguments)
+	assert.Equal(t, "SELECT facet.value::text AS value, count(*) AS count FROM mytable, LATERAL unnest(tags) AS facet(value) "+
+		"WHERE (title = $1 OR year > $2) AND facet.value IS NOT NULL GROUP BY 1 ORDER BY count DESC, value LIMIT $3", facets[1].SQL)
+	assert.Equal(t, "SELECT (address->>'city')::text AS value, count(*) AS count FROM mytable "+
+		"WHERE (title = $1 OR year > $2) AND (address->>'city') IS NOT NULL GROUP BY 1 ORDER BY count DESC, value LIMIT $3", facets[2].SQL)
+	assert.Equal(t, "SELECT facet.value::text AS value, count(*) AS count FROM mytable, LATERAL jsonb_array_elements_text(doc->'subjects') AS facet(value) "+
+		"WHERE (title = $1 OR year > $2) AND facet.value IS NOT NULL GROUP BY 1 ORDER BY count DESC, value LIMIT $3", facets[3].SQL)
+
+	_, err = def.GenerateFacets(context.Background(), q, "mytable", []string{"foo"}, 10)
+	assert.EqualError(t, err, "unknown facet foo")
+
+	q, err = parser.Parse("foo = a")
+	assert.NoError(t, err)
+	_, err = def.GenerateFacets(context.Background(), q, "mytable", []string{"year"}, 10)
+	assert.EqualError(t, err, "unknown field foo")
+}
+
+func TestScan(t *testing.T) {
+	def := NewDefinition()
+	def.AddField("title", NewFieldString().WithExact())
+	def.AddField("year", NewFieldNumber())
+	def.AddField("any", NewFieldCombo(false, []Field{}))
+
+	scan, err := def.GenerateScan(context.Background(), "title = comp", "mytable", 2, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "title", scan.Index)
+	assert.Equal(t, "comp", scan.Term)
+	assert.Equal(t, "SELECT (title)::text AS term, count(*) AS count FROM mytable WHERE (title) IS NOT NULL "+
+		"AND (title) < $1 GROUP BY (title) ORDER BY (title) DESC LIMIT $2", scan.Before.SQL)
+	assert.Equal(t, []any{"comp", 1}, scan.Before.Arguments)
+	assert.Equal(t, "SELECT (title)::text AS term, count(*) AS count FROM mytable WHERE (title) IS NOT NULL "+
+		"AND (title) >= $1 GROUP BY (title) ORDER BY (title) LIMIT $2", scan.After.SQL)
+	assert.Equal(t, []any{"comp", 4}, scan.After.Arguments)
+
+	scan, err = def.GenerateScan(context.Background(), "\"comp\"", "mytable", 1, 5)
+	assert.EqualError(t, err, "unknown field cql.serverChoice")
+	assert.Nil(t, scan)
+
+	scan, err = def.GenerateScan(context.Background(), "year = 1984", "mytable", 0, 3)
+	assert.NoError(t, err)
+	assert.Nil(t, scan.Before)
+	assert.Equal(t, "SELECT (year)::text AS term, count(*) AS count FROM mytable WHERE (year) IS NOT NULL "+
+		"AND (year) > $1 GROUP BY (year) ORDER BY (year) LIMIT $2", scan.After.SQL)
+	assert.Equal(t, []any{1984.0, 3}, scan.After.Arguments)
+
+	scan, err = def.GenerateScan(context.Background(), "year = 1984", "mytable", 4, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{1984.0, 3}, scan.Before.Arguments)
+	assert.Nil(t, scan.After)
+
+	scan, err = def.GenerateScan(context.Background(), "title = \"\"", "mytable", 3, 3)
+	assert.NoError(t, err)
+	assert.Nil(t, scan.Before)
+	assert.Equal(t, "SELECT (title)::text AS term, count(*) AS count FROM mytable WHERE (title) IS NOT NULL "+
+		"GROUP BY (title) ORDER BY (title) LIMIT $1", scan.After.SQL)
+	assert.Equal(t, []any{1}, scan.After.Arguments)
+
+	for _, testcase := range []struct {
+		scanClause string
+		expected   string
+	}{
+		{"title = a and title = b", "scan clause must be a single search clause"},
+		{"title = a sortby title", "scan clause must be a single search clause"},
+		{"title > a", "unsupported scan relation >"},
+		{"year = x", "invalid number x"},
+		{"foo = a", "unknown field foo"},
+		{"any = a", "field any does not support scan"},
+		{"title = (", "search term expected at position 9: title = (̰"},
+	} {
+		_, err := def.GenerateScan(context.Background(), testcase.scanClause, "mytable", 1, 10)
+		assert.EqualErrorf(t, err, testcase.expected, "scan clause %s", testcase.scanClause)
+	}
+	_, err = def.GenerateScan(context.Background(), "title = a", "mytable", 1, 0)
+	assert.EqualError(t, err, "maximumTerms must be positive")
+	_, err = def.GenerateScan(context.Background(), "title = a", "mytable", -1, 10)
+	assert.EqualError(t, err, "responsePosition must not be negative")
+}
+
+func TestScanResponse(t *testing.T) {
+	var sr ScanResponse
+	buf, err := sr.MarshalIndent([]ScanTerm{{Value: "a<b", NumberOfRecords: 2}, {Value: "c", NumberOfRecords: 1}}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, `<scanResponse xmlns="http://docs.oasis-open.org/ns/search-ws/scan">
+  <terms>
+    <term>
+      <value>a&lt;b</value>
+      <numberOfRecords>2</numberOfRecords>
+    </term>
+    <term>
+      <value>c</value>
+      <numberOfRecords>1</numberOfRecords>
+    </term>
+  </terms>
+</scanResponse>
+`, string(buf))
+
+	buf, err = sr.MarshalIndent([]ScanTerm{}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "<scanResponse xmlns=\"http://docs.oasis-open.org/ns/search-ws/scan\">\n</scanResponse>\n", string(buf))
+}
+
+func TestCostGuard(t *testing.T) {
+	plan := `[{"Plan": {"Node Type": "Nested Loop", "Total Cost": 1200.5, "Plan Rows": 40,
+		"Plans": [
+			{"Node Type": "Seq Scan", "Relation Name": "mytable", "Alias": "mytable", "Total Cost": 1000, "Plan Rows": 40},
+			{"Node Type": "Index Scan", "Relation Name": "publisher", "Alias": "publisher", "Total Cost": 0.3, "Plan Rows": 1}
+		]}}]`
+
+	guard := &CostGuard{}
+	report, err := guard.evaluate([]byte(plan))
+	assert.NoError(t, err)
+	assert.True(t, report.Ok())
+	assert.Equal(t, 1200.5, report.TotalCost)
+	assert.Equal(t, float64(40), report.Rows)
+	assert.Equal(t, []string{"mytable"}, report.SeqScans)
+	assert.Equal(t, "Index Scan", report.Plan.Plans[1].NodeType)
+
+	guard = &CostGuard{MaxTotalCost: 1000, MaxRows: 10, SeqScanTables: []string{"public.MyTable", "publisher"}}
+	report, err = guard.evaluate([]byte(plan))
+	assert.NoError(t, err)
+	assert.False(t, report.Ok())
+	assert.Equal(t, []CostViolation{
+		{Kind: ViolationTotalCost, Value: 1200.5, Limit: 1000},
+		{Kind: ViolationRows, Value: 40, Limit: 10},
+		{Kind: ViolationSeqScan, Relation: "mytable"},
+	}, report.Violations)
+	assert.Equal(t, "query too expensive: total cost 1200.5 exceeds 1000; rows 40 exceeds 10; seq scan on mytable",
+		(&CostError{Report: report}).Error())
+
+	_, err = guard.evaluate([]byte("{}"))
+	assert.ErrorContains(t, err, "invalid EXPLAIN output")
+	_, err = guard.evaluate([]byte("[]"))
+	assert.EqualError(t, err, "invalid EXPLAIN output: expected one plan")
+}
+
+func TestIndexes(t *testing.T) {
+	def := NewDefinition()
+	def.AddField("title", NewFieldString().WithFullText("english"))
+	def.AddField("author", NewFieldString().WithLikeOps().WithLower().WithPrefixMatchOnly())
+	def.AddField("subject", NewFieldString().WithILikeOps().WithFuzzy(0))
+	def.AddField("code", NewFieldString().WithExact().WithPhonetic(PhoneticSoundex))
+	def.AddField("country", NewFieldString().WithExact().WithColumn("address->>'country'"))
+	def.AddField("publisher", NewFieldString().WithExact().WithColumn("publisher.name"))
+	def.AddField("year", NewFieldNumber())
+	def.AddField("active", NewFieldBool())
+	def.AddField("period", NewFieldRange(RangeDate))
+	def.AddField("vector", NewFieldTsVector().WithColumn("full_vector"))
+	def.AddField("barcode", NewFieldRelated("item", "instance_id", "instance.id", NewFieldString().WithExact()))
+	def.AddField("cql.serverChoice", NewFieldCombo(false, []Field{
+		NewFieldString().WithColumn("title").WithFullText("english"),
+		NewFieldString().WithColumn("code").WithExact(),
+	}))
+	// templates get no index, as their expressions are unknown
+	def.AddField("age", NewFieldTemplate(TermNumber).WithColumn("year").WithTemplate(cql.LT, "2030 - {column} < {arg}"))
+	def.AddField("created", NewFieldTemplate(TermDate).WithTemplate(cql.EQ, "{column}::date = {arg}").WithSort("{column}"))
+
+	var ddl []string
+	for _, r := range def.RecommendIndexes("instance") {
+		ddl = append(ddl, r.DDL())
+	}
+	assert.Equal(t, []string{
+		"CREATE INDEX ON instance USING btree ((address->>'country'))",
+		"CREATE INDEX ON instance USING btree (code)",
+		"CREATE INDEX ON instance USING gin (full_vector)",
+		"CREATE INDEX ON instance USING btree (lower(author) text_pattern_ops)",
+		"CREATE INDEX ON instance USING gist (period)",
+		"CREATE INDEX ON instance USING btree (soundex(code))",
+		"CREATE INDEX ON instance USING gin (subject gin_trgm_ops)",
+		"CREATE INDEX ON instance USING gin (to_tsvector('english', title))",
+		"CREATE INDEX ON instance USING btree (year)",
+		"CREATE INDEX ON item USING btree (barcode)",
+		"CREATE INDEX ON item USING btree (instance_id)",
+		"CREATE INDEX ON publisher USING btree (name)",
+	}, ddl)
+
+	recommendations := def.RecommendIndexes("instance")
+	for _, r := range recommendations {
+		assert.NotContains(t, r.Fields, "age")
+		assert.NotContains(t, r.Fields, "created")
+	}
+	assert.Equal(t, IndexRecommendation{Fields: []string{"code", "cql.serverchoice"}, Table: "instance", Method: "btree", Key: "code"}, recommendations[1])
+	assert.Equal(t, IndexRecommendation{Fields: []string{"subject"}, Table: "instance", Method: "gin", Key: "subject gin_trgm_ops", Extension: "pg_trgm"}, recommendations[6])
+	assert.Equal(t, []string{"barcode"}, recommendations[10].Fields)
+
+	for _, testcase := range []struct {
+		recommendation int
+		indexdef       string
+		expected       bool
+	}{
+		{1, "CREATE INDEX instance_code_idx ON public.instance USING btree (code)", true},
+		{1, "CREATE UNIQUE INDEX instance_code_idx ON public.instance USING btree (code, year)", true},
+		{1, "CREATE INDEX instance_code_idx ON public.instance USING btree (year, code)", false},
+		{1, "CREATE INDEX instance_code_idx ON public.instance USING hash (code)", false},
+		{0, "CREATE INDEX country_idx ON public.instance USING btree (((address ->> 'country'::text)))", true},
+		{3, "CREATE INDEX author_idx ON public.instance USING btree (lower((author)::text) varchar_pattern_ops)", true},
+		{3, "CREATE INDEX author_idx ON public.instance USING btree (lower(author))", false},
+		{6, "CREATE INDEX subject_idx ON public.instance USING gin (subject gin_trgm_ops)", true},
+		{6, "CREATE INDEX subject_idx ON public.instance USING gist (subject gist_trgm_ops)", true},
+		{7, "CREATE INDEX title_idx ON public.instance USING gin (to_tsvector('english'::regconfig, title))", true},
+		{7, "CREATE INDEX title_idx ON public.instance USING gin (to_tsvector('simple'::regconfig, title))", false},
+		{7, "not an index", false},
+	} {
+		assert.Equal(t, testcase.expected, indexMatches(recommendations[testcase.recommendation], testcase.indexdef), testcase.indexdef)
+	}
+}
+
+func TestSchemaColumns(t *testing.T) {
+	def := NewPgDefinition()
+	def.AddField("barcode", NewFieldRelated("item", "instance_id", "instance.id", NewFieldString().WithExact()))
+
+	assert.Equal(t, []schemaColumn{
+		{column: "r1.instance_id", from: "item r1"},
+		{column: "r1.barcode", from: "item r1", kind: "string"},
+	}, fieldSchemaColumns(def.GetFieldType("barcode")))
+	assert.Equal(t, []schemaColumn{
+		{column: "title", kind: "string"},
+		{column: "vector", kind: "tsvector"},
+		{column: "period", kind: "range", typeName: "daterange"},
+	}, fieldSchemaColumns(NewFieldCombo(false, []Field{
+		NewFieldString().WithColumn("title"),
+		NewFieldTsVector().WithColumn("vector"),
+		NewFieldRange(RangeDate).WithColumn("period"),
+	})))
+	assert.Equal(t, []schemaColumn{{column: "legacy"}}, fieldSchemaColumns(&legacyField{FieldCommon{column: "legacy"}}))
+
+	for _, testcase := range []struct {
+		column   schemaColumn
+		typeName string
+		category string
+		expected bool
+	}{
+		{schemaColumn{kind: "string"}, "varchar", "S", true},
+		{schemaColumn{kind: "string"}, "jsonb", "U", false},
+		{schemaColumn{kind: "number"}, "int4", "N", true},
+		{schemaColumn{kind: "number"}, "text", "S", false},
+		{schemaColumn{kind: "datetime"}, "timestamptz", "D", true},
+		{schemaColumn{kind: "boolean"}, "bool", "B", true},
+		{schemaColumn{kind: "range", typeName: "daterange"}, "daterange", "R", true},
+		{schemaColumn{kind: "range", typeName: "daterange"}, "int4range", "R", false},
+		{schemaColumn{kind: "tsvector"}, "tsvector", "U", true},
+		{schemaColumn{kind: "tsvector"}, "text", "S", false},
+		{schemaColumn{kind: "array"}, "_text", "A", true},
+		{schemaColumn{}, "anything", "X", true},
+	} {
+		assert.Equal(t, testcase.expected, testcase.column.typeMatches(testcase.typeName, testcase.category), testcase)
+	}
+}
+
+// fakeRows are rows returned by fakeQuerier, with values of the types scanned into.
+type fakeRows struct {
+	columns []string
+	rows    [][]any
+	i       int
+}
+
+func (r *fakeRows) Close()                        {}
+func (r *fakeRows) Err() error                    { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag { return pgconn.CommandTag{} }
+func (r *fakeRows) Conn() *pgx.Conn               { return nil }
+func (r *fakeRows) RawValues() [][]byte           { return nil }
+
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription {
+	fields := make([]pgconn.FieldDescription, len(r.columns))
+	for i, column := range r.columns {
+		fields[i].Name = column
+	}
+	return fields
+}
+
+func (r *fakeRows) Next() bool {
+	r.i++
+	return r.i <= len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	if scanner, ok := dest[0].(pgx.RowScanner); ok && len(dest) == 1 {
+		return scanner.ScanRow(r)
+	}
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.rows[r.i-1][i]))
+	}
+	return nil
+}
+
+func (r *fakeRows) Values() ([]any, error) {
+	return r.rows[r.i-1], nil
+}
+
+// fakeQuerier records the statements and returns the results in order.
+type fakeQuerier struct {
+	sql     []string
+	args    [][]any
+	results []*fakeRows
+}
+
+func (q *fakeQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	q.sql = append(q.sql, sql)
+	q.args = append(q.args, args)
+	rows := q.results[0]
+	q.results = q.results[1:]
+	return rows, nil
+}
+
+func TestSearch(t *testing.T) {
+	def := NewPgDefinition()
+	def.AddField("title", NewFieldString().WithExact())
+	var parser cql.Parser
+	q, err := parser.Parse("title = a sortby title")
+	assert.NoError(t, err)
+	query, err := def.Parse(q, 1)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	type item struct {
+		Id    int64
+		Title string
+	}
+	conn := &fakeQuerier{results: []*fakeRows{
+		{columns: []string{"id", "title"}, rows: [][]any{{int64(1), "a"}, {int64(2), "a"}}},
+		{columns: []string{"count"}, rows: [][]any{{int64(12)}}},
+	}}
+	req := SearchRequest{From: "mytable", Columns: []string{"id", "title"}, Offset: 10, Limit: 2}
+	res, err := Search(ctx, conn, query, req, pgx.RowToStructByName[item])
+	assert.NoError(t, err)
+	assert.Equal(t, &SearchResult[item]{Items: []item{{1, "a"}, {2, "a"}}, Total: 12}, res)
+	assert.Equal(t, []string{
+		"SELECT id, title FROM mytable WHERE title = $1 ORDER BY title LIMIT $2 OFFSET $3",
+		"SELECT count(*) FROM mytable WHERE title = $1",
+	}, conn.sql)
+	assert.Equal(t, [][]any{{"a", 2, 10}, {"a"}}, conn.args)
+
+	conn = &fakeQuerier{results: []*fakeRows{
+		{columns: []string{"id", "title", "total_count"}, rows: [][]any{{int64(1), "a", int64(3)}}},
+	}}
+	req = SearchRequest{From: "mytable", Columns: []string{"id", "title"}, Count: CountWindow}
+	res, err = Search(ctx, conn, query, req, pgx.RowToStructByName[item])
+	assert.NoError(t, err)
+	assert.Equal(t, &SearchResult[item]{Items: []item{{1, "a"}}, Total: 3}, res)
+	assert.Equal(t, []string{"SELECT id, title, count(*) OVER() AS total_count FROM mytable WHERE title = $1 ORDER BY title"}, conn.sql)
+
+	conn = &fakeQuerier{results: []*fakeRows{
+		{columns: []string{"id", "total_count"}},
+		{columns: []string{"count"}, rows: [][]any{{int64(3)}}},
+	}}
+	req = SearchRequest{From: "mytable", Columns: []string{"id"}, Offset: 5, Count: CountWindow}
+	maps, err := SearchMaps(ctx, conn, query, req)
+	assert.NoError(t, err)
+	assert.Equal(t, &SearchResult[map[string]any]{Items: []map[string]any{}, Total: 3}, maps)
+	assert.Equal(t, "SELECT count(*) FROM mytable WHERE title = $1", conn.sql[1])
+
+	conn = &fakeQuerier{results: []*fakeRows{
+		{columns: []string{"id", "total_count"}, rows: [][]any{{int64(1), int64(3)}}},
+	}}
+	req = SearchRequest{From: "mytable", Columns: []string{"id"}, Count: CountWindow}
+	maps, err = SearchMaps(ctx, conn, query, req)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"id": int64(1)}}, maps.Items)
+
+	conn = &fakeQuerier{results: []*fakeRows{
+		{columns: []string{"id"}, rows: [][]any{{int64(1)}}},
+		{columns: []string{"QUERY PLAN"}, rows: [][]any{{[]byte(`[{"Plan": {"Node Type": "Seq Scan", "Total Cost": 10, "Plan Rows": 42}}]`)}}},
+	}}
+	req = SearchRequest{From: "mytable", Columns: []string{"id"}, Count: CountEstimate}
+	maps, err = SearchMaps(ctx, conn, query, req)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), maps.Total)
+	assert.True(t, maps.TotalEstimated)
+	assert.Equal(t, "EXPLAIN (FORMAT JSON) SELECT 1 FROM mytable WHERE title = $1", conn.sql[1])
+
+	conn = &fakeQuerier{results: []*fakeRows{{columns: []string{"id"}}}}
+	maps, err = SearchMaps(ctx, conn, query, SearchRequest{From: "mytable", Count: CountNone})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), maps.Total)
+	assert.Equal(t, []string{"SELECT * FROM mytable WHERE title = $1 ORDER BY title"}, conn.sql)
+
+	// without a row or columns there is no count column to hide
+	var total int64
+	empty := windowRows{Rows: &fakeRows{rows: [][]any{{}}}, total: &total}
+	assert.True(t, empty.Next())
+	assert.Nil(t, empty.RawValues())
+	assert.Empty(t, empty.FieldDescriptions())
+	values, err := empty.Values()
+	assert.NoError(t, err)
+	assert.Empty(t, values)
+}
+
+func TestSQLArguments(t *testing.T) {
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 500, time.FixedZone("CEST", 7200))
+	args := SQLArguments([]any{"a", int64(1), ts,
+		[]string{"a", `b "c" \d`}, []int64{1, -2}, []float64{1.5, 2}, []bool{true, false}, []time.Time{ts}})
+	assert.Equal(t, []any{"a", int64(1), ts.UTC(),
+		pgArray(`{"a","b \"c\" \\d"}`), pgArray("{1,-2}"), pgArray("{1.5,2}"), pgArray("{true,false}"),
+		pgArray(`{"2024-05-06T05:08:09.0000005Z"}`)}, args)
+	value, err := args[3].(driver.Valuer).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a","b \"c\" \\d"}`, value)
+}
+
+type sqlStateErr string
+
+func (e sqlStateErr) Error() string    { return "sql error " + string(e) }
+func (e sqlStateErr) SQLState() string { return string(e) }
+
+func TestClassifyError(t *testing.T) {
+	var parser cql.Parser
+	_, parseErr := parser.Parse("title =")
+	assert.Error(t, parseErr)
+
+	for _, testcase := range []struct {
+		err      error
+		kind     ErrorKind
+		status   int
+		sqlState string
+		diag     string
+	}{
+		{parseErr, ErrorInvalidQuery, 400, "", "info:srw/diagnostic/1/10"},
+		{&PgError{message: "unknown field x"}, ErrorInvalidQuery, 400, "", "info:srw/diagnostic/1/10"},
+		{fmt.Errorf("search: %w", &PermissionError{Reason: "field ssn"}), ErrorPermission, 403, "", "info:srw/diagnostic/1/3"},
+		{fmt.Errorf("search: %w", &CostError{Report: &CostReport{Violations: []CostViolation{{Kind: ViolationSeqScan, Relation: "instance"}}}}),
+			ErrorTooExpensive, 422, "", "info:srw/diagnostic/1/48"},
+		{context.DeadlineExceeded, ErrorTimeout, 504, "", "info:srw/diagnostic/1/2"},
+		{sqlStateErr("57014"), ErrorTimeout, 504, "57014", "info:srw/diagnostic/1/2"},
+		{sqlStateErr("22P02"), ErrorInvalidQuery, 400, "22P02", "info:srw/diagnostic/1/10"},
+		{sqlStateErr("08006"), ErrorUnavailable, 503, "08006", "info:srw/diagnostic/1/2"},
+		{sqlStateErr("42703"), ErrorInternal, 500, "42703", "info:srw/diagnostic/1/1"},
+		{driver.ErrBadConn, ErrorUnavailable, 503, "", "info:srw/diagnostic/1/2"},
+		{&SchemaError{}, ErrorInternal, 500, "", "info:srw/diagnostic/1/1"},
+	} {
+		queryError := ClassifyError(testcase.err)
+		assert.Equal(t, testcase.kind, queryError.Kind, testcase.err.Error())
+		assert.Equal(t, testcase.status, queryError.HTTPStatus(), testcase.err.Error())
+		assert.Equal(t, testcase.sqlState, queryError.SQLState, testcase.err.Error())
+		assert.Equal(t, testcase.diag, queryError.Diagnostic().URI, testcase.err.Error())
+		assert.Equal(t, testcase.err.Error(), queryError.Diagnostic().Details)
+		assert.ErrorIs(t, queryError, testcase.err)
+		assert.Equal(t, testcase.err.Error(), queryError.Error())
+		assert.Same(t, queryError, ClassifyError(fmt.Errorf("again: %w", queryError)))
+	}
+	assert.Nil(t, ClassifyError(nil))
+
+	// a CostGuard rejection is reported as a query too complex
+	diagnostic := ClassifyError(&CostError{Report: &CostReport{Violations: []CostViolation{{Kind: ViolationSeqScan, Relation: "instance"}}}}).Diagnostic()
+	assert.Equal(t, Diagnostic{URI: "info:srw/diagnostic/1/48", Message: "Query too complex",
+		Details: "query too expensive: seq scan on instance"}, diagnostic)
+}
+
+func TestContextSets(t *testing.T) {
+	const dc = "http://purl.org/dc/elements/1.1/"
+	const bath = "http://zing.z3950.org/cql/bath/2.0/"
+	def := NewDefinition()
+	def.WithContextSet("dc", dc).WithContextSet("bath", bath).WithDefaultContextSet(dc)
+	def.AddField("dc.title", NewFieldString().WithExact().WithColumn("title"))
+	def.AddField("dc.creator", NewFieldString().WithExact().WithColumn("author"))
+	def.AddField("bath.name", NewFieldString().WithExact().WithColumn("name"))
+	def.AddField("year", NewFieldNumber())
+	def.AddField("cql.serverChoice", NewFieldString().WithExact().WithColumn("title"))
+
+	assert.NotNil(t, def.GetFieldType("title"))
+	assert.NotNil(t, def.GetFieldType("DC.Title"))
+	assert.Nil(t, def.GetFieldType("name"))
+
+	var parser cql.Parser
+	for _, testcase := range []struct {
+		query    string
+		expected string
+	}{
+		{"dc.title = a", "title = $1"},
+		{"title = a", "title = $1"},
+		{"Title = a", "title = $1"},
+		{"year = 1", "year = $1"},
+		{"> x = \"" + dc + "\" x.title = a", "title = $1"},
+		{"> dc = \"" + bath + "\" dc.name = a", "name = $1"},
+		{"> \"" + bath + "\" name = a and year = 2", "name = $1 AND year = $2"},
+		{"(> x = \"" + dc + "\" x.creator = a) or (> x = \"" + bath + "\" x.name = b)", "author = $1 OR name = $2"},
+		{"> x = \"" + dc + "\" (x.title = a and (> x = \"" + bath + "\" x.name = b))", "title = $1 AND name = $2"},
+		{"> c = \"" + CQLContextSet + "\" c.serverChoice = a", "title = $1"},
+		{"a", "title = $1"},
+	} {
+		q, err := parser.Parse(testcase.query)
+		assert.NoError(t, err, testcase.query)
+		res, err := def.Parse(q, 1)
+		if assert.NoError(t, err, testcase.query) {
+			assert.Equal(t, testcase.expected, res.GetWhereClause(), testcase.query)
+		}
+	}
+
+	for _, testcase := range []struct {
+		query    string
+		expected string
+	}{
+		{"x.title = a", "unknown field x.title"},
+		{"> x = \"" + bath + "\" x.title = a", "unknown field x.title"},
+		{"bath.name = a and x.name = b", "unknown field x.name"},
+		{"> dc = \"" + bath + "\" dc.title = a", "unknown field dc.title"},
+		{"> \"" + bath + "\" title = a", "unknown field title"},
+		{"> dc = \"" + bath + "\" dc.name = a sortby dc.title", "unknown field dc.title"},
+	} {
+		q, err := parser.Parse(testcase.query)
+		assert.NoError(t, err, testcase.query)
+		_, err = def.Parse(q, 1)
+		assert.EqualError(t, err, testcase.expected, testcase.query)
+	}
+
+	q, err := parser.Parse("> x = \"" + dc + "\" x.title = a sortby x.creator/sort.descending title")
+	assert.NoError(t, err)
+	res, err := def.Parse(q, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, " ORDER BY author DESC, title", res.GetOrderByClause())
+
+	policy := &Policy{DeniedFields: []string{"dc.creator"}}
+	q, err = parser.Parse("> x = \"" + dc + "\" x.creator = a")
+	assert.NoError(t, err)
+	_, err = def.ParseContext(WithPolicy(context.Background(), policy), q, 1)
+	assert.EqualError(t, err, "permission denied for dc.creator = a: field dc.creator")
+
+	scan, err := def.GenerateScan(context.Background(), "> x = \""+dc+"\" x.creator = a", "mytable", 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT (author)::text AS term, count(*) AS count FROM mytable WHERE (author) IS NOT NULL AND (author) >= $1 GROUP BY (author) ORDER BY (author) LIMIT $2", scan.After.SQL)
+
+	// prefixes of well-known context sets need no declaration
+	known := NewPgDefinition()
+	known.AddField("dc.title", NewFieldString().WithExact().WithColumn("title"))
+	q, err = parser.Parse("> x = \"" + cql.ContextSetDC + "\" x.title = a")
+	assert.NoError(t, err)
+	res, err = known.Parse(q, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "title = $1", res.GetWhereClause())
+	}
+}
+
+func TestCompose(t *testing.T) {
+	base := NewDefinition()
+	base.AddField("title", NewFieldString().WithExact())
+	base.AddField("year", NewFieldNumber())
+	base.AddField("contributor", NewFieldRelated("contributor", "instance_id", "instance.id",
+		NewFieldString().WithExact().WithColumn("name")))
+	base.AddFieldGroup("contributor", "contributor")
+	base.AddFacet("year", NewFacet())
+
+	tenant := base.Clone()
+	tenant.AddField("title", NewFieldString().WithExact().WithColumn("tenant_title"))
+	tenant.RemoveField("year")
+	tenant.RemoveFacet("year")
+	tenant.WithNullPolicy(NullNonMatch)
+
+	generate := func(def Definition, query string) (string, error) {
+		var parser cql.Parser
+		q, err := parser.Parse(query)
+		assert.NoError(t, err, query)
+		res, err := def.Parse(q, 1)
+		if err != nil {
+			return "", err
+		}
+		return res.GetWhereClause(), nil
+	}
+	for _, testcase := range []struct {
+		def      Definition
+		query    string
+		expected string
+		err      string
+	}{
+		{base, "title = a", "title = $1", ""},
+		{base, "title <> a", "title <> $1", ""},
+		{base, "year = 2000", "year = $1", ""},
+		{tenant, "title = a", "tenant_title = $1", ""},
+		{tenant, "title <> a", "tenant_title IS DISTINCT FROM $1", ""},
+		{tenant, "year = 2000", "", "unknown field year"},
+		{tenant, "contributor = a", "EXISTS (SELECT 1 FROM contributor r1 WHERE r1.instance_id = instance.id AND r1.name = $1)", ""},
+	} {
+		where, err := generate(testcase.def, testcase.query)
+		if testcase.err != "" {
+			assert.EqualError(t, err, testcase.err, testcase.query)
+		} else if assert.NoError(t, err, testcase.query) {
+			assert.Equal(t, testcase.expected, where, testcase.query)
+		}
+	}
+	assert.NotNil(t, base.GetFacet("year"))
+	assert.Nil(t, tenant.GetFacet("year"))
+
+	holdings := NewDefinition()
+	holdings.AddField("location", NewFieldString().WithExact().WithColumn("holdings.location"))
+	holdings.AddField("callNumber", NewFieldRelated("item", "holdings_id", "holdings.id",
+		NewFieldString().WithExact().WithColumn("call_number")))
+	holdings.AddField("barcode", NewFieldRelated("item", "holdings_id", "holdings.id",
+		NewFieldString().WithExact().WithColumn("it.barcode")).WithAlias("it"))
+	holdings.AddFieldGroup("item", "callNumber")
+	holdings.AddFacet("location", NewFacet().WithColumn("holdings.location"))
+	tenant.Mount("holdings", holdings)
+	assert.Panics(t, func() { tenant.Mount("items", nil) })
+	assert.Nil(t, tenant.GetFieldType("location"))
+	assert.NotNil(t, tenant.GetFacet("holdings.location"))
+	for _, testcase := range []struct {
+		query    string
+		expected string
+	}{
+		{"holdings.location = a", "holdings.location = $1"},
+		// the alias r1 of item in holdings is taken by contributor in tenant
+		{"holdings.callNumber = a", "EXISTS (SELECT 1 FROM item r2 WHERE r2.holdings_id = holdings.id AND r2.call_number = $1)"},
+		{"holdings.callNumber = a and holdings.callNumber = b",
+			"EXISTS (SELECT 1 FROM item r2 WHERE r2.holdings_id = holdings.id AND (r2.call_number = $1 AND r2.call_number = $2))"},
+		{"holdings.barcode = a", "EXISTS (SELECT 1 FROM item it WHERE it.holdings_id = holdings.id AND it.barcode = $1)"},
+		{"contributor = a and holdings.callNumber = b",
+			"EXISTS (SELECT 1 FROM contributor r1 WHERE r1.instance_id = instance.id AND r1.name = $1) AND " +
+				"EXISTS (SELECT 1 FROM item r2 WHERE r2.holdings_id = holdings.id AND r2.call_number = $2)"},
+		{"title = a and holdings.location <> b", "tenant_title = $1 AND holdings.location IS DISTINCT FROM $2"},
+	} {
+		where, err := generate(tenant, testcase.query)
+		if assert.NoError(t, err, testcase.query) {
+			assert.Equal(t, testcase.expected, where, testcase.query)
+		}
+	}
+	// the mounted definition is unchanged
+	where, err := generate(holdings, "location <> a")
+	assert.NoError(t, err)
+	assert.Equal(t, "holdings.location <> $1", where)
+	where, err = generate(holdings, "callNumber = a")
+	assert.NoError(t, err)
+	assert.Equal(t, "EXISTS (SELECT 1 FROM item r1 WHERE r1.holdings_id = holdings.id AND r1.call_number = $1)", where)
+
+	// definitions can be changed while they are used
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				where, err := generate(base, "title = a")
+				assert.NoError(t, err)
+				assert.Equal(t, "title = $1", where)
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		base.AddField(fmt.Sprintf("field%d", j), NewFieldString().WithExact())
+		base.Clone().RemoveField("title")
+	}
+	wg.Wait()
+	assert.NotNil(t, base.GetFieldType("field99"))
+}
+
+func TestDefinitionHolder(t *testing.T) {
+	newDef := func(column string) *PgDefinition {
+		def := NewDefinition()
+		def.AddField("title", NewFieldString().WithExact().WithColumn(column))
+		def.AddFacet("title", NewFacet().WithColumn(column))
+		return def
+	}
+	var empty DefinitionHolder
+	assert.Nil(t, empty.Load())
+	assert.Equal(t, "", empty.Version())
+
+	first := newDef("title1")
+	holder := NewDefinitionHolder(first)
+	assert.Equal(t, "1", holder.Version())
+	assert.Equal(t, "", first.GetVersion())
+
+	var parser cql.Parser
+	q, err := parser.Parse("title = a")
+	assert.NoError(t, err)
+	res, err := holder.Parse(q, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "title1 = $1", res.GetWhereClause())
+	assert.Equal(t, "1", res.GetVersion())
+
+	previous := holder.Swap(newDef("title2").WithVersion("abc"))
+	assert.Same(t, first, previous)
+	res, err = holder.ParseContext(context.Background(), q, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "title2 = $1", res.GetWhereClause())
+	assert.Equal(t, "abc", res.GetVersion())
+
+	facets, err := holder.GenerateFacets(context.Background(), q, "mytable", []string{"title"}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", facets[0].Version)
+	scan, err := holder.GenerateScan(context.Background(), "title = a", "mytable", 2, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", scan.Version)
+	assert.Equal(t, "abc", scan.Before.Version)
+	assert.Equal(t, "abc", scan.After.Version)
+
+	err = holder.Reload(func() (*PgDefinition, error) {
+		return nil, fmt.Errorf("bad config")
+	})
+	assert.EqualError(t, err, "bad config")
+	assert.Equal(t, "abc", holder.Version())
+	err = holder.Reload(func() (*PgDefinition, error) {
+		return newDef("title3"), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "3", holder.Version())
+
+	// queries are generated by a single definition while definitions are swapped
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var parser cql.Parser
+			q, err := parser.Parse("title = a")
+			assert.NoError(t, err)
+			for j := 0; j < 100; j++ {
+				res, err := holder.Parse(q, 1)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "title"+res.GetVersion()+" = $1", res.GetWhereClause())
+				}
+			}
+		}()
+	}
+	for j := 4; j < 100; j++ {
+		holder.Swap(newDef(fmt.Sprintf("title%d", j)))
+	}
+	wg.Wait()
+
+	// concurrent swaps leave the definition with the latest version
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				holder.Swap(NewDefinition())
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, "199", holder.Version())
+
+	// without a definition no queries are generated
+	assert.Nil(t, holder.Swap(nil).GetFieldType("title"))
+	for _, holder := range []*DefinitionHolder{&empty, holder} {
+		_, err = holder.Parse(q, 1)
+		assert.EqualError(t, err, "no definition")
+		_, err = holder.GenerateFacets(context.Background(), q, "mytable", []string{"title"}, 10)
+		assert.EqualError(t, err, "no definition")
+		_, err = holder.GenerateScan(context.Background(), "title = a", "mytable", 2, 3)
+		assert.EqualError(t, err, "no definition")
+	}
+	assert.Nil(t, holder.Load())
+	err = holder.Reload(func() (*PgDefinition, error) {
+		return nil, nil
+	})
+	assert.EqualError(t, err, "no definition")
+}
+
+func TestFieldTemplate(t *testing.T) {
+	def := NewDefinition()
+	def.AddField("name", NewFieldTemplate(TermString).WithColumn("author").
+		WithTemplate(cql.EQ, "coalesce({column}, title) = {arg}").
+		WithTemplate(cql.ADJ, "{column} ILIKE '%' || {arg} || '%' OR title ILIKE '%' || {arg} || '%'").
+		WithSort("coalesce({column}, title)"))
+	def.AddField("doc", NewFieldTemplate(TermString).WithTemplate("==", "jsonb_path_exists({column}, {arg}::jsonpath)"))
+	def.AddField("age", NewFieldTemplate(TermNumber).WithColumn("year").WithTemplate(cql.LT, "2030 - {column} < {arg}"))
+	def.AddField("week", NewFieldTemplate(TermDate).WithTemplate(cql.EQ, "created BETWEEN {arg}::date - 6 AND {arg}::date"))
+	def.AddField("active", NewFieldTemplate(TermBool).WithTemplate(cql.EQ, "{column} IS NOT DISTINCT FROM {arg}"))
+	def.AddField("missing", NewFieldTemplate(TermString).WithTemplate(cql.EQ, "{column} IS NULL"))
+
+	var parser cql.Parser
+	for _, testcase := range []struct {
+		query    string
+		expected string
+		args     []any
+		err      string
+	}{
+		{query: "name = knuth", expected: "(coalesce(author, title) = $1)", args: []any{"knuth"}},
+		{query: "name = \"a\\*b\"", expected: "(coalesce(author, title) = $1)", args: []any{"a*b"}},
+		{query: "name ADJ knuth", expected: "(author ILIKE '%' || $1 || '%' OR title ILIKE '%' || $1 || '%')", args: []any{"knuth"}},
+		{query: "name adj knuth and age < 30", expected: "(author ILIKE '%' || $1 || '%' OR title ILIKE '%' || $1 || '%') AND (2030 - year < $2)",
+			args: []any{"knuth", float64(30)}},
+		{query: "age < 30 not name adj knuth", expected: "(2030 - year < $1) AND NOT (author ILIKE '%' || $2 || '%' OR title ILIKE '%' || $2 || '%')",
+			args: []any{float64(30), "knuth"}},
+		{query: "name = knuth sortby name", expected: "(coalesce(author, title) = $1) ORDER BY coalesce(author, title)", args: []any{"knuth"}},
+		{query: "name = knuth sortby age", err: "field age does not support sorting"},
+		{query: "doc == \"$.a ? (@ > 1)\"", err: "masking op ? unsupported"},
+		{query: "doc ==/unmasked \"$.a ? (@ > 1)\"", expected: "(jsonb_path_exists(doc, $1::jsonpath))", args: []any{"$.a ? (@ > 1)"}},
+		{query: "age < 30", expected: "(2030 - year < $1)", args: []any{float64(30)}},
+		{query: "age < x", err: "invalid number x"},
+		{query: "age = 30", err: "unsupported relation ="},
+		{query: "week = 2024-01-31", expected: "(created BETWEEN $1::date - 6 AND $1::date)",
+			args: []any{time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)}},
+		{query: "week = 2024", err: "partial date 2024 unsupported in template"},
+		{query: "week = 2024-01", err: "partial date 2024-01 unsupported in template"},
+		{query: "week = x", err: "invalid date time x, it should be in format YYYY-MM-DD, YYYY-MM-DD HH:MM:SS, YYYY-MM-DDTHH:MM:SSZ, YYYY-MM-DDTHH:MM:SS±HH:MM, " + partialDateFormats},
+		{query: "active = yes", expected: "(active IS NOT DISTINCT FROM $1)", args: []any{true}},
+		{query: "active = maybe", err: "invalid bool maybe"},
+		{query: "missing = x", expected: "(missing IS NULL)", args: []any{}},
+		{query: "name = a and age < 30", expected: "(coalesce(author, title) = $1) AND (2030 - year < $2)", args: []any{"a", float64(30)}},
+	} {
+		q, err := parser.Parse(testcase.query)
+		assert.NoError(t, err, testcase.query)
+		res, err := def.Parse(q, 1)
+		if testcase.err != "" {
+			assert.EqualError(t, err, testcase.err, testcase.query)
+			continue
+		}
+		if assert.NoError(t, err, testcase.query) {
+			assert.Equal(t, testcase.expected, res.GetWhereClause()+res.GetOrderByClause(), testcase.query)
+			assert.Equal(t, testcase.args, res.GetQueryArguments(), testcase.query)
+		}
+	}
+
+	q, err := parser.Parse("name adj knuth")
+	assert.NoError(t, err)
+	res, err := def.ParseContext(context.Background(), q, 1)
+	assert.NoError(t, err)
+	rendered := res.Render(RenderOptions{Style: PlaceholderQuestion})
+	assert.Equal(t, "(author ILIKE '%' || ? || '%' OR title ILIKE '%' || ? || '%')", rendered.WhereClause)
+	assert.Equal(t, []any{"knuth", "knuth"}, rendered.Arguments)
+
+	assert.Equal(t, []schemaColumn{{column: "author"}}, def.GetFieldType("name").(schemaField).schemaColumns())
+	assert.Nil(t, def.GetFieldType("week").(schemaField).schemaColumns())
+
+	clone := def.Clone()
+	clone.GetFieldType("name").(*FieldTemplate).WithTemplate(cql.EQ, "{column} = {arg}")
+	res, err = def.ParseContext(context.Background(), cql.Query{Clause: cql.Clause{SearchClause: &cql.SearchClause{Index: "name", Relation: cql.EQ, Term: "x"}}}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "(coalesce(author, title) = $1)", res.GetWhereClause())
+	assert.Nil(t, def.GetFieldType("name").(indexedField).indexKeys())
+}
@@ -2,12 +2,14 @@ package pgcql
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/indexdata/cql-go/cql"
 	"github.com/jackc/pgx/v5"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/stretchr/testify/assert"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
@@ -111,6 +113,8 @@ func TestPgx(t *testing.T) {
 		def.AddField("country", NewFieldString().WithExact().WithColumn("address->>'country'"))
 		def.AddField("zip", NewFieldNumber().WithColumn("address->'zip'"))
 		def.AddField("zip2", NewFieldNumber().WithColumn("(address->'zip')::numeric"))
+		def.AddField("zip3", NewFieldNumber().WithDecimal().WithColumn("(address->'zip')::numeric"))
+		def.AddField("yeari", NewFieldNumber().WithInteger().WithColumn("year"))
 		def.AddField("start_date", NewFieldDate().WithOnlyDate())
 		def.AddField("created_at", NewFieldDate())
 		def.AddField("is_active", NewFieldBool())
@@ -162,14 +166,31 @@ func TestPgx(t *testing.T) {
 			{"zip >= 0", []int{1, 2}},
 			{"zip = \"\"", []int{1, 2}},
 			{"zip2 = 19601", []int{1}},
+			{"zip3 = 19601.0", []int{1}},
+			{"zip3 any \"19601 67890.00\"", []int{1, 2}},
+			{"yeari = 1984", []int{2}},
+			{"yeari any \"1968 2025 2030\"", []int{1, 3}},
 			{"start_date >= 2026-03-05", []int{1, 2}},
 			{"start_date > 2026-03-05", []int{2}},
 			{"start_date = 2026-03-05", []int{1}},
 			{"created_at > 2026-03-05", []int{1, 2}},
 			{"created_at > 2026-03-05 10:00:00", []int{2}},
 			{"created_at = \"\"", []int{1, 2}},
+			{"start_date = 2026", []int{1, 2}},
+			{"start_date = 2026-02", []int{}},
+			{"start_date <> 2026-03", []int{}},
+			{"start_date <= 2026-03", []int{1, 2}},
+			{"created_at = 2026-03", []int{1, 2}},
+			{"created_at > 2026-02", []int{1, 2}},
+			{"created_at > 2026", []int{}},
+			{"created_at =/isoDate 2026-W10", []int{1, 2}},
+			{"created_at < now", []int{1, 2}},
 			{"is_active = true", []int{1}},
 			{"is_active = 0", []int{2}},
+			{"is_active any \"0 1\"", []int{1, 2}},
+			{"year any \"1968 2025\"", []int{1, 3}},
+			{"year <> \"1968 2025\"", []int{2}},
+			{"start_date any \"2026-03-05 2026-03-07\"", []int{1}},
 			{"full_vector all \"some text2\"", []int{2}},
 			{"full_vector any \"text2 text1\"", []int{1, 2}},
 		} {
@@ -309,6 +330,414 @@ func TestPgx(t *testing.T) {
 		}
 	})
 
+	t.Run("fuzzy ops", func(t *testing.T) {
+		_, err := conn.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS pg_trgm")
+		assert.NoError(t, err, "failed to create extension pg_trgm")
+		_, err = conn.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS fuzzystrmatch")
+		assert.NoError(t, err, "failed to create extension fuzzystrmatch")
+
+		def := NewPgDefinition()
+		def.AddField("title", NewFieldString().WithFuzzy(0.5).WithFuzzyRank())
+		def.AddField("city", NewFieldString().WithPhonetic(PhoneticSoundex).WithColumn("address->>'city'"))
+
+		var parser cql.Parser
+		for _, testcase := range []struct {
+			query       string
+			expectedIds []int
+		}{
+			{"title =/fuzzy \"the texbok\"", []int{2}},
+			{"title <>/fuzzy \"the texbok\"", []int{1, 3}},
+			{"city =/phonetic Redding", []int{1}},
+			{"city =/phonetic Stamford", []int{2}},
+		} {
+			runQuery(t, parser, conn, ctx, def, testcase.query, testcase.expectedIds)
+		}
+	})
+
+	t.Run("range ops", func(t *testing.T) {
+		_, err := conn.Exec(ctx, "ALTER TABLE mytable ADD COLUMN active_years int4range")
+		assert.NoError(t, err, "failed to add active_years")
+		_, err = conn.Exec(ctx, "UPDATE mytable SET active_years = int4range(year, year + 10) WHERE year < 2000")
+		assert.NoError(t, err, "failed to update active_years")
+
+		def := NewPgDefinition()
+		def.AddField("year", NewFieldNumber())
+		def.AddField("start_date", NewFieldDate().WithOnlyDate())
+		def.AddField("active", NewFieldRange(RangeInt4).WithColumn("active_years"))
+
+		var parser cql.Parser
+		for _, testcase := range []struct {
+			query       string
+			expectedIds []int
+		}{
+			{"year within \"1960 1990\"", []int{1, 2}},
+			{"year within \"1968 1968\"", []int{1}},
+			{"start_date within \"2026-03-06 2026-12-31\"", []int{2}},
+			{"active = 1970", []int{1}},
+			{"active = 1978", []int{}},
+			{"active within \"1960 2000\"", []int{1, 2}},
+			{"active within \"1960 1980\"", []int{1}},
+			{"active encloses \"1970 1975\"", []int{1}},
+			{"active =/partial \"1975 1985\"", []int{1, 2}},
+			{"active < 1980", []int{1}},
+			{"active >= 1980", []int{2}},
+		} {
+			runQuery(t, parser, conn, ctx, def, testcase.query, testcase.expectedIds)
+		}
+	})
+
+	t.Run("null ops", func(t *testing.T) {
+		sqlDef := NewPgDefinition()
+		sqlDef.AddField("author", NewFieldString().WithLikeOps())
+		sqlDef.AddField("is_active", NewFieldBool())
+		sqlDef.AddField("title", NewFieldString().WithExact())
+
+		def := NewDefinition().WithNullPolicy(NullNonMatch)
+		def.AddField("author", NewFieldString().WithLikeOps())
+		def.AddField("tag", NewFieldString().WithSplit().WithExact())
+		def.AddField("authorEmpty", NewFieldString().WithExact().WithColumn("author").WithNullPolicy(NullEmpty))
+		def.AddField("is_active", NewFieldBool())
+		def.AddField("start_date", NewFieldDate().WithOnlyDate())
+		def.AddField("title", NewFieldString().WithExact())
+
+		var parser cql.Parser
+		for _, testcase := range []struct {
+			query       string
+			expectedIds []int
+		}{
+			{"author <> \"d. e. knuth\"", []int{1}},
+			{"is_active <> true", []int{2}},
+			{"title = \"\" not is_active = true", []int{2}},
+			{"author <> \"\"", []int{1, 2}},
+		} {
+			runQuery(t, parser, conn, ctx, sqlDef, testcase.query, testcase.expectedIds)
+		}
+		for _, testcase := range []struct {
+			query       string
+			expectedIds []int
+		}{
+			{"author <> \"d. e. knuth\"", []int{1, 3}},
+			{"author <> d*", []int{3}},
+			{"tag <> \"tag1 tag3\"", []int{2, 3}},
+			{"authorEmpty == \"\"", []int{3}},
+			{"authorEmpty <> \"d. e. knuth\"", []int{1, 3}},
+			{"is_active <> true", []int{2, 3}},
+			{"start_date <> 2026-03", []int{3}},
+			{"title = \"\" not is_active = true", []int{2, 3}},
+			{"author <> \"\"", []int{1, 2}},
+			{"author =/missing \"\"", []int{3}},
+			{"authorEmpty <> \"\"", []int{1, 2}},
+		} {
+			runQuery(t, parser, conn, ctx, def, testcase.query, testcase.expectedIds)
+		}
+	})
+
+	t.Run("related ops", func(t *testing.T) {
+		_, err := conn.Exec(ctx, "CREATE TABLE contributor (id SERIAL PRIMARY KEY, mytable_id INT REFERENCES mytable(id), name TEXT, role TEXT)")
+		assert.NoError(t, err, "failed to create contributor")
+		_, err = conn.Exec(ctx, "INSERT INTO contributor (mytable_id, name, role) VALUES "+
+			"(1, 'knuth', 'author'), (2, 'knuth', 'author'), (2, 'addison', 'editor'), (3, 'anon', 'editor')")
+		assert.NoError(t, err, "failed to insert contributors")
+
+		def := NewDefinition()
+		def.AddField("contributor", NewFieldRelated("contributor", "mytable_id", "mytable.id", NewFieldString().WithLikeOps().WithColumn("name")))
+		def.AddField("role", NewFieldRelated("contributor", "mytable_id", "mytable.id", NewFieldString().WithExact()))
+		def.AddField("title", NewFieldString().WithExact())
+
+		var parser cql.Parser
+		for _, testcase := range []struct {
+			query       string
+			expectedIds []int
+		}{
+			{"contributor = knuth", []int{1, 2}},
+			{"contributor = a*", []int{2, 3}},
+			{"role = editor", []int{2, 3}},
+			{"role = editor and contributor = knuth", []int{2}},
+			{"title = \"\" not role = editor", []int{1}},
+			{"contributor = nobody", []int{}},
+			{"contributor = knuth and role = editor", []int{2}},
+		} {
+			runQuery(t, parser, conn, ctx, def, testcase.query, testcase.expectedIds)
+		}
+
+		def.AddFieldGroup("contributor", "contributor", "role")
+		for _, testcase := range []struct {
+			query       string
+			expectedIds []int
+		}{
+			{"contributor = knuth and role = editor", []int{}},
+			{"contributor = knuth and role = author", []int{1, 2}},
+			{"contributor = a* and title = \"\" and role = editor", []int{2, 3}},
+			{"contributor = knuth not role = author", []int{}},
+			{"contributor = knuth not role = editor", []int{1}},
+		} {
+			runQuery(t, parser, conn, ctx, def, testcase.query, testcase.expectedIds)
+		}
+	})
+
+	t.Run("named args", func(t *testing.T) {
+		def := NewDefinition()
+		def.AddField("title", NewFieldString().WithExact())
+		def.AddField("year", NewFieldNumber().WithInteger())
+
+		var parser cql.Parser
+		q, err := parser.Parse("title = \"the TeXbook\" or year any \"1968 2025\" sortby year/sort.descending")
+		assert.NoError(t, err)
+		pgQuery, err := def.ParseContext(ctx, q, 1)
+		assert.NoError(t, err)
+		res := pgQuery.Render(RenderOptions{Style: PlaceholderNamed})
+		rows, err := conn.Query(ctx, "SELECT id FROM mytable WHERE "+res.WhereClause+res.OrderByClause, pgx.NamedArgs(res.NamedArguments))
+		assert.NoError(t, err)
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+		assert.NoError(t, err)
+		assert.Equal(t, []int{3, 2, 1}, ids)
+	})
+
+	t.Run("scope", func(t *testing.T) {
+		def := NewDefinition()
+		def.AddField("title", NewFieldString().WithExact())
+		def.AddField("author", NewFieldString().WithExact())
+		def.AddScope("year < $1", 2000)
+
+		var parser cql.Parser
+		for _, testcase := range []struct {
+			query       string
+			expectedIds []int
+		}{
+			{"title = \"\"", []int{1, 2}},
+			{"title = \"anonymous' list\"", []int{}},
+			{"title = \"anonymous' list\" or author = \"d. e. knuth\"", []int{2}},
+			{"title = \"\" not author = \"d. e. knuth\"", []int{1}},
+		} {
+			runQuery(t, parser, conn, ctx, def, testcase.query, testcase.expectedIds)
+		}
+	})
+
+	t.Run("cost guard", func(t *testing.T) {
+		def := NewPgDefinition()
+		def.AddField("title", NewFieldString().WithExact())
+
+		var parser cql.Parser
+		q, err := parser.Parse("title = \"the TeXbook\"")
+		assert.NoError(t, err)
+		pgQuery, err := def.Parse(q, 1)
+		assert.NoError(t, err)
+
+		guard := &CostGuard{MaxTotalCost: 1e9}
+		report, err := guard.Explain(ctx, conn, "SELECT id FROM mytable", pgQuery)
+		assert.NoError(t, err)
+		assert.True(t, report.Ok())
+		assert.Greater(t, report.TotalCost, float64(0))
+
+		guard = &CostGuard{SeqScanTables: []string{"mytable"}}
+		report, err = guard.Explain(ctx, conn, "SELECT id FROM mytable", pgQuery)
+		var costError *CostError
+		assert.ErrorAs(t, err, &costError)
+		assert.Equal(t, []string{"mytable"}, report.SeqScans)
+		assert.Equal(t, "seq scan on mytable", report.Message())
+
+		guard.WarnOnly = true
+		report, err = guard.Explain(ctx, conn, "SELECT id FROM mytable", pgQuery)
+		assert.NoError(t, err)
+		assert.False(t, report.Ok())
+	})
+
+	t.Run("facets", func(t *testing.T) {
+		def := NewDefinition()
+		def.AddField("year", NewFieldNumber())
+		def.AddFacet("country", NewFacet().WithColumn("address->>'country'"))
+		def.AddFacet("tags", NewFacet().WithArray().WithColumn("string_to_array(tag, ' ')"))
+
+		var parser cql.Parser
+		q, err := parser.Parse("year > 1900")
+		assert.NoError(t, err)
+		results, err := GetFacets(ctx, conn, def, q, "mytable", []string{"country", "tags"}, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []FacetResult{
+			{Name: "country", Buckets: []FacetBucket{{Value: "USA", Count: 2}, {Value: "Unknown country", Count: 1}}},
+			{Name: "tags", Buckets: []FacetBucket{{Value: "tag1", Count: 1}, {Value: "tag2", Count: 1}}},
+		}, results)
+
+		results, err = GetFacets(ctx, conn, def, q, "mytable", []string{"country"}, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []FacetResult{{Name: "country", Buckets: []FacetBucket{{Value: "USA", Count: 2}}}}, results)
+	})
+
+	t.Run("scan", func(t *testing.T) {
+		def := NewDefinition()
+		def.AddField("year", NewFieldNumber())
+
+		terms, err := Scan(ctx, conn, def, "year = 1984", "mytable", 2, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []ScanTerm{{"1968", 1}, {"1984", 1}, {"2025", 1}}, terms)
+
+		terms, err = Scan(ctx, conn, def, "year = 1984", "mytable", 0, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []ScanTerm{{"2025", 1}}, terms)
+
+		terms, err = Scan(ctx, conn, def, "year = 2000", "mytable", 3, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, []ScanTerm{{"1968", 1}, {"1984", 1}}, terms)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		def := NewPgDefinition()
+		def.AddField("year", NewFieldNumber().WithInteger())
+
+		var parser cql.Parser
+		q, err := parser.Parse("year > 1900 sortby year")
+		assert.NoError(t, err)
+		pgQuery, err := def.Parse(q, 1)
+		assert.NoError(t, err)
+
+		type book struct {
+			Id    int
+			Title string
+		}
+		for _, count := range []CountMode{CountExact, CountWindow} {
+			req := SearchRequest{From: "mytable", Columns: []string{"id", "title"}, Offset: 1, Limit: 1, Count: count}
+			res, err := Search(ctx, conn, pgQuery, req, pgx.RowToStructByName[book])
+			assert.NoError(t, err)
+			assert.Equal(t, &SearchResult[book]{Items: []book{{2, "the TeXbook"}}, Total: 3}, res)
+		}
+
+		req := SearchRequest{From: "mytable", Columns: []string{"id"}, Offset: 5, Count: CountWindow}
+		maps, err := SearchMaps(ctx, conn, pgQuery, req)
+		assert.NoError(t, err)
+		assert.Empty(t, maps.Items)
+		assert.Equal(t, int64(3), maps.Total)
+
+		req = SearchRequest{From: "mytable", Columns: []string{"id"}, Limit: 1, Count: CountEstimate}
+		maps, err = SearchMaps(ctx, conn, pgQuery, req)
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]any{{"id": int32(1)}}, maps.Items)
+		assert.True(t, maps.TotalEstimated)
+	})
+
+	t.Run("database/sql", func(t *testing.T) {
+		db, err := sql.Open("pgx", connStr)
+		assert.NoError(t, err)
+		defer db.Close()
+
+		def := NewPgDefinition()
+		def.AddField("title", NewFieldString().WithExact().WithSplit())
+		def.AddField("year", NewFieldNumber().WithInteger())
+		def.AddField("created", NewFieldDate().WithColumn("created_at"))
+
+		var parser cql.Parser
+		for _, testcase := range []struct {
+			query       string
+			expectedIds []int
+		}{
+			{"title any \"foo \\\"the TeXbook\\\"\"", []int{}},
+			{"year any \"1968 1984\" sortby year/sort.descending", []int{2, 1}},
+			{"created < 2026-03-06", []int{1}},
+		} {
+			q, err := parser.Parse(testcase.query)
+			assert.NoError(t, err, testcase.query)
+			pgQuery, err := def.Parse(q, 1)
+			assert.NoError(t, err, testcase.query)
+			rows, err := QuerySQL(ctx, db, "SELECT id FROM mytable", pgQuery)
+			assert.NoError(t, err, testcase.query)
+			ids := make([]int, 0)
+			for rows.Next() {
+				var id int
+				assert.NoError(t, rows.Scan(&id))
+				ids = append(ids, id)
+			}
+			assert.NoError(t, rows.Err())
+			assert.Equal(t, testcase.expectedIds, ids, testcase.query)
+		}
+
+		q, err := parser.Parse("title = x")
+		assert.NoError(t, err)
+		pgQuery, err := def.Parse(q, 1)
+		assert.NoError(t, err)
+		_, err = QuerySQL(ctx, db, "SELECT id FROM missing", pgQuery)
+		var queryError *QueryError
+		assert.ErrorAs(t, err, &queryError)
+		assert.Equal(t, "42P01", queryError.SQLState)
+		assert.Equal(t, ErrorInternal, queryError.Kind)
+	})
+
+	t.Run("templates", func(t *testing.T) {
+		def := NewPgDefinition()
+		def.AddField("name", NewFieldTemplate(TermString).WithTemplate(cql.EQ, "coalesce(author, title) = {arg}"))
+		def.AddField("zip", NewFieldTemplate(TermString).WithColumn("address").
+			WithTemplate(cql.EQ, "jsonb_path_exists({column}, {arg}::jsonpath)"))
+		def.AddField("age", NewFieldTemplate(TermNumber).WithColumn("year").WithTemplate(cql.GE, "2030 - {column} >= {arg}"))
+		def.AddField("week", NewFieldTemplate(TermDate).WithColumn("start_date").
+			WithTemplate(cql.EQ, "{column} BETWEEN {arg}::date - 6 AND {arg}::date"))
+		def.AddField("active", NewFieldTemplate(TermBool).WithColumn("is_active").
+			WithTemplate(cql.EQ, "{column} IS NOT DISTINCT FROM {arg}"))
+
+		var parser cql.Parser
+		for _, testcase := range []struct {
+			query       string
+			expectedIds []int
+		}{
+			{"name = \"d. e. knuth\"", []int{2}},
+			{"name = \"anonymous' list\"", []int{3}},
+			{"zip =/unmasked \"$.zip ? (@ > 50000)\"", []int{2}},
+			{"age >= 50", []int{1}},
+			{"week = 2026-03-06", []int{1, 2}},
+			{"active = no", []int{2}},
+		} {
+			runQuery(t, parser, conn, ctx, def, testcase.query, testcase.expectedIds)
+		}
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		def := NewDefinition()
+		def.AddField("title", NewFieldString().WithLikeOps())
+		def.AddField("year", NewFieldNumber())
+		def.AddField("created", NewFieldDate().WithColumn("created_at"))
+		def.AddField("active", NewFieldBool().WithColumn("is_active"))
+		def.AddField("vector", NewFieldTsVector().WithColumn("full_vector"))
+		def.AddField("publisher", NewFieldString().WithExact().WithColumn("publisher.name"))
+		def.AddFacet("country", NewFacet().WithColumn("address->>'country'"))
+		assert.NoError(t, def.Validate(ctx, conn, "mytable"))
+
+		def.AddField("titel", NewFieldString().WithExact())
+		def.AddField("author", NewFieldNumber())
+		def.AddFacet("tags", NewFacet().WithArray().WithColumn("tag"))
+		err := def.Validate(ctx, conn, "mytable")
+		assert.EqualError(t, err, "definition does not match schema: author: column author has type text, expected number; "+
+			"titel: column \"titel\" does not exist; facet tags: column tag has type text, expected array")
+		var schemaError *SchemaError
+		assert.ErrorAs(t, err, &schemaError)
+		assert.Equal(t, SchemaProblem{Field: "titel", Column: "titel", Message: "column \"titel\" does not exist"}, schemaError.Problems[1])
+	})
+
+	t.Run("indexes", func(t *testing.T) {
+		def := NewDefinition()
+		def.AddField("author", NewFieldString().WithLikeOps().WithLower())
+		def.AddField("year", NewFieldNumber())
+		def.AddField("publisher", NewFieldString().WithExact().WithColumn("publisher.name"))
+		def.AddField("id", NewFieldNumber().WithInteger())
+
+		missing, err := CheckIndexes(ctx, conn, def, "mytable")
+		assert.NoError(t, err)
+		var ddl []string
+		for _, r := range missing {
+			ddl = append(ddl, r.DDL())
+		}
+		assert.Equal(t, []string{
+			"CREATE INDEX ON mytable USING btree (lower(author) text_pattern_ops)",
+			"CREATE INDEX ON mytable USING btree (year)",
+			"CREATE INDEX ON publisher USING btree (name)",
+		}, ddl)
+
+		for _, statement := range ddl[:2] {
+			_, err = conn.Exec(ctx, statement)
+			assert.NoError(t, err, statement)
+		}
+		missing, err = CheckIndexes(ctx, conn, def, "mytable")
+		assert.NoError(t, err)
+		assert.Len(t, missing, 1)
+		assert.Equal(t, []string{"publisher"}, missing[0].Fields)
+	})
+
 	err = pgContainer.Terminate(ctx)
 	assert.NoError(t, err, "failed to stop db container")
 }